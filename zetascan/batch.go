@@ -0,0 +1,227 @@
+package zetascan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BatchResult carries the outcome of a single item in a batch query
+type BatchResult struct {
+	Item   string
+	Record JsonRecord
+	Err    error
+}
+
+// workers returns the configured concurrency, at least one
+func (myapi Api) workers() int {
+
+	if myapi.Concurrency < 1 {
+		return 1
+	}
+
+	return myapi.Concurrency
+}
+
+// QueryStream queries each item received on items, emitting results as they complete with at most
+// Concurrency lookups in flight. The returned channel is closed once items is closed and drained, or
+// when ctx is cancelled (pending items are then left unread and no further results are sent).
+func (myapi Api) QueryStream(ctx context.Context, items <-chan string) <-chan BatchResult {
+
+	out := make(chan BatchResult)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < myapi.workers(); i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for {
+
+				var item string
+				var ok bool
+
+				select {
+				case <-ctx.Done():
+					return
+				case item, ok = <-items:
+					if !ok {
+						return
+					}
+				}
+
+				m, err := myapi.QueryContext(ctx, item)
+
+				select {
+				case <-ctx.Done():
+					return
+				case out <- BatchResult{Item: item, Record: m, Err: err}:
+				}
+
+			}
+
+		}()
+
+	}
+
+	// Close once every worker has finished
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// QueryReader reads one item per line from r and queries them like QueryStream, emitting results as
+// they complete. Blank lines and lines starting with # are skipped. A read error is emitted as a
+// final BatchResult with an empty Item, unless ctx is done first.
+func (myapi Api) QueryReader(ctx context.Context, r io.Reader) (<-chan BatchResult, error) {
+
+	if r == nil {
+		return nil, errors.New("a reader must be specified")
+	}
+
+	items := make(chan string)
+
+	// The read error, sent once the feeder is done with r
+	scanErrs := make(chan error, 1)
+
+	// Feed the lines to the workers
+	go func() {
+
+		defer close(items)
+
+		scanner := bufio.NewScanner(r)
+
+		for scanner.Scan() {
+
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case items <- line:
+			}
+
+		}
+
+		scanErrs <- scanner.Err()
+
+	}()
+
+	results := myapi.QueryStream(ctx, items)
+	out := make(chan BatchResult)
+
+	// Forward the results, then report any read error once every line has been handled
+	go func() {
+
+		defer close(out)
+
+		for result := range results {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- result:
+			}
+		}
+
+		// The workers also stop on ctx, the feeder may still be blocked reading
+		var scanErr error
+
+		select {
+		case <-ctx.Done():
+			return
+		case scanErr = <-scanErrs:
+		}
+
+		if scanErr != nil {
+			select {
+			case <-ctx.Done():
+			case out <- BatchResult{Err: scanErr}:
+			}
+		}
+
+	}()
+
+	return out, nil
+}
+
+// QueryBatch queries every item with at most Concurrency lookups in flight and returns a result per
+// item, aligned with items. A failed item carries its error while the others keep their record, so
+// a transient failure doesn't lose the successful lookups. Items not queried before ctx is done
+// carry ctx.Err().
+func (myapi Api) QueryBatch(ctx context.Context, items []string) []BatchResult {
+
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < myapi.workers(); i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			// Each item writes its own slot
+			for i := range indexes {
+				m, err := myapi.QueryContext(ctx, items[i])
+				results[i] = BatchResult{Item: items[i], Record: m, Err: err}
+			}
+
+		}()
+
+	}
+
+	for i, item := range items {
+
+		select {
+		case <-ctx.Done():
+			results[i] = BatchResult{Item: item, Err: ctx.Err()}
+			continue
+		case indexes <- i:
+		}
+
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// QueryBatchAsync queries every item like QueryBatch, calling onResult as each lookup finishes
+// instead of waiting for the whole batch. The calls are serialized, onResult needs no locking, and
+// QueryBatchAsync returns once it was called for every item (run it in a goroutine to carry on).
+func (myapi Api) QueryBatchAsync(items []string, onResult func(item string, rec JsonRecord, err error)) {
+
+	queue := make(chan string)
+
+	go func() {
+
+		defer close(queue)
+
+		for _, item := range items {
+			queue <- item
+		}
+
+	}()
+
+	for result := range myapi.QueryStream(context.Background(), queue) {
+		onResult(result.Item, result.Record, result.Err)
+	}
+}
@@ -0,0 +1,221 @@
+package zetascan
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryReader(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("baddomain.org", "127.9.9.1")))
+	myapi.ApiMethod = "json"
+
+	input := "baddomain.org\n\n# a comment\nokdomain.org\n  127.9.9.1  \n#127.9.9.2\n"
+
+	results, err := myapi.QueryReader(context.Background(), strings.NewReader(input))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]bool)
+	var items []string
+
+	for result := range results {
+
+		if result.Err != nil {
+			t.Fatalf("%s: %v", result.Item, result.Err)
+		}
+
+		items = append(items, result.Item)
+		found[result.Item] = result.Record.Results[0].Found
+	}
+
+	sort.Strings(items)
+
+	if strings.Join(items, " ") != "127.9.9.1 baddomain.org okdomain.org" {
+		t.Fatalf("results for %v, want the three items", items)
+	}
+
+	if found["baddomain.org"] == false || found["127.9.9.1"] == false || found["okdomain.org"] {
+		t.Errorf("unexpected listings %v", found)
+	}
+}
+
+func TestQueryBatchPartialFailure(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if strings.HasSuffix(r.URL.Path, "/fail.example") {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+
+		listedHandler("baddomain.org")(w, r)
+	})))
+	myapi.ApiMethod = "json"
+
+	items := []string{"baddomain.org", "fail.example", "okdomain.org", "fail.example", ""}
+
+	results := myapi.QueryBatch(context.Background(), items)
+
+	if len(results) != len(items) {
+		t.Fatalf("%d results for %d items", len(results), len(items))
+	}
+
+	for i, result := range results {
+
+		if result.Item != items[i] {
+			t.Errorf("results[%d] is for %q, want %q", i, result.Item, items[i])
+		}
+
+		failed := items[i] == "fail.example" || items[i] == ""
+
+		if (result.Err != nil) != failed {
+			t.Errorf("%q: err = %v, want failed %t", items[i], result.Err, failed)
+		}
+	}
+
+	if results[0].Record.Results[0].Found == false || results[2].Record.Results[0].Found {
+		t.Errorf("unexpected records %+v, %+v", results[0].Record, results[2].Record)
+	}
+
+	if errors.Is(results[4].Err, ErrEmptyQuery) == false {
+		t.Errorf("empty item: err = %v, want ErrEmptyQuery", results[4].Err)
+	}
+}
+
+func TestQueryBatchAsync(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if strings.HasSuffix(r.URL.Path, "/fail.example") {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+
+		listedHandler("baddomain.org")(w, r)
+	})))
+	myapi.ApiMethod = "json"
+
+	items := []string{"baddomain.org", "fail.example", "okdomain.org", ""}
+
+	calls := make(map[string]int)
+	records := make(map[string]JsonRecord)
+	errs := make(map[string]error)
+
+	// The callbacks are serialized, the maps need no locking
+	myapi.QueryBatchAsync(items, func(item string, rec JsonRecord, err error) {
+		calls[item]++
+		records[item] = rec
+		errs[item] = err
+	})
+
+	if len(calls) != len(items) {
+		t.Fatalf("called for %v, want %v", calls, items)
+	}
+
+	for _, item := range items {
+		if calls[item] != 1 {
+			t.Errorf("%q: called %d times, want once", item, calls[item])
+		}
+	}
+
+	for _, item := range []string{"baddomain.org", "okdomain.org"} {
+
+		if errs[item] != nil {
+			t.Fatalf("%q: %v", item, errs[item])
+		}
+
+		if rec := records[item]; len(rec.Results) != 1 || rec.Results[0].Item != item || rec.Results[0].Found != (item == "baddomain.org") {
+			t.Errorf("%q: record %+v", item, rec)
+		}
+	}
+
+	if errs["fail.example"] == nil {
+		t.Error("fail.example: no error for a 500")
+	}
+
+	if errors.Is(errs[""], ErrEmptyQuery) == false {
+		t.Errorf("empty item: err = %v, want ErrEmptyQuery", errs[""])
+	}
+}
+
+func TestQueryReaderCancel(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("baddomain.org")))
+	myapi.ApiMethod = "json"
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The reader is still blocked on its second read when the query is canceled
+	results, err := myapi.QueryReader(ctx, &errReader{delay: 50 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := <-results; result.Item != "baddomain.org" || result.Err != nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	cancel()
+
+	select {
+	case result, ok := <-results:
+		if ok {
+			t.Errorf("result %+v after cancel", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("results not closed after cancel")
+	}
+
+	// Let the read fail after the results closed
+	time.Sleep(100 * time.Millisecond)
+}
+
+// errReader returns a line, then fails after delay
+type errReader struct {
+	read  bool
+	delay time.Duration
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+
+	if r.read {
+		time.Sleep(r.delay)
+		return 0, errors.New("disk on fire")
+	}
+
+	r.read = true
+
+	return copy(p, "baddomain.org\n"), nil
+}
+
+func TestQueryReaderError(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("baddomain.org")))
+	myapi.ApiMethod = "json"
+
+	results, err := myapi.QueryReader(context.Background(), &errReader{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []BatchResult
+
+	for result := range results {
+		got = append(got, result)
+	}
+
+	if len(got) != 2 || got[0].Item != "baddomain.org" || got[0].Err != nil || got[1].Item != "" || got[1].Err == nil {
+		t.Errorf("results %+v, want the item then the read error", got)
+	}
+}
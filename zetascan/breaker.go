@@ -0,0 +1,156 @@
+package zetascan
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker, see WithCircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed queries go through, failures are counted
+	CircuitClosed CircuitState = iota
+	// CircuitOpen queries fail fast with ErrCircuitOpen until the cooldown passes
+	CircuitOpen
+	// CircuitHalfOpen a single probe query goes through, its outcome closes or reopens the circuit
+	CircuitHalfOpen
+)
+
+// String returns a readable name for the state
+func (state CircuitState) String() string {
+
+	switch state {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+// circuitBreaker tracks the web endpoint failures, shared by copies of an Api
+type circuitBreaker struct {
+	sync.Mutex
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+
+	state    CircuitState
+	count    int
+	firstAt  time.Time
+	openedAt time.Time
+	probeAt  time.Time
+}
+
+// WithCircuitBreaker returns a copy of the Api that stops sending web queries after failures
+// consecutive failures (connection errors or 5xx, retries included) within window (zero for no
+// limit): they then fail fast with ErrCircuitOpen, or fall back to DNS (see WithFallback). After
+// cooldown one probe query goes through (half-open), closing the circuit on success or reopening
+// it on failure. Copies of the returned Api share the breaker. The receiver is not modified.
+func (myapi Api) WithCircuitBreaker(failures int, window, cooldown time.Duration) Api {
+
+	if failures < 1 {
+		failures = 1
+	}
+
+	myapi.breaker = &circuitBreaker{failures: failures, window: window, cooldown: cooldown}
+
+	return myapi
+}
+
+// CircuitState returns the state of the circuit breaker, CircuitClosed without WithCircuitBreaker
+func (myapi Api) CircuitState() CircuitState {
+
+	if myapi.breaker == nil {
+		return CircuitClosed
+	}
+
+	myapi.breaker.Lock()
+	defer myapi.breaker.Unlock()
+
+	return myapi.breaker.current(time.Now())
+}
+
+// current returns the state at now, an open circuit past its cooldown is half-open
+func (breaker *circuitBreaker) current(now time.Time) CircuitState {
+
+	if breaker.state == CircuitOpen && now.Sub(breaker.openedAt) >= breaker.cooldown {
+		return CircuitHalfOpen
+	}
+
+	return breaker.state
+}
+
+// allow reports if a query may go through, letting one probe per cooldown through when half-open
+func (breaker *circuitBreaker) allow() bool {
+
+	if breaker == nil {
+		return true
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	now := time.Now()
+
+	switch breaker.current(now) {
+	case CircuitClosed:
+		return true
+
+	case CircuitHalfOpen:
+
+		// A probe is already in flight
+		if breaker.state == CircuitHalfOpen && now.Sub(breaker.probeAt) < breaker.cooldown {
+			return false
+		}
+
+		breaker.state = CircuitHalfOpen
+		breaker.probeAt = now
+
+		return true
+	}
+
+	return false
+}
+
+// record counts the outcome of a query let through by allow
+func (breaker *circuitBreaker) record(ok bool) {
+
+	if breaker == nil {
+		return
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	now := time.Now()
+
+	if ok {
+		breaker.state = CircuitClosed
+		breaker.count = 0
+		return
+	}
+
+	// A failed probe reopens the circuit
+	if breaker.state == CircuitHalfOpen {
+		breaker.state = CircuitOpen
+		breaker.openedAt = now
+		return
+	}
+
+	// Only failures within the window add up (any consecutive failures without one)
+	if breaker.count == 0 || (breaker.window > 0 && now.Sub(breaker.firstAt) > breaker.window) {
+		breaker.count = 0
+		breaker.firstAt = now
+	}
+
+	breaker.count++
+
+	if breaker.count >= breaker.failures {
+		breaker.state = CircuitOpen
+		breaker.openedAt = now
+		breaker.count = 0
+	}
+}
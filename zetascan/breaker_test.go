@@ -0,0 +1,75 @@
+package zetascan
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+
+	const cooldown = 100 * time.Millisecond
+
+	var healthy, calls int32
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		atomic.AddInt32(&calls, 1)
+
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		listedHandler()(w, r)
+	})))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithCircuitBreaker(2, 0, cooldown)
+
+	state := func(want CircuitState) {
+		t.Helper()
+		if got := myapi.CircuitState(); got != want {
+			t.Fatalf("CircuitState = %v, want %v", got, want)
+		}
+	}
+
+	// Two failures open the circuit
+	for i := 0; i < 2; i++ {
+		state(CircuitClosed)
+		myapi.Query("okdomain.org")
+	}
+
+	state(CircuitOpen)
+
+	if _, err := myapi.Query("okdomain.org"); errors.Is(err, ErrCircuitOpen) == false || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("err = %v after %d requests, want ErrCircuitOpen without a request", err, atomic.LoadInt32(&calls))
+	}
+
+	// A failed probe reopens it
+	time.Sleep(cooldown)
+	state(CircuitHalfOpen)
+
+	if _, err := myapi.Query("okdomain.org"); errors.Is(err, ErrCircuitOpen) || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("err = %v after %d requests, want the probe sent", err, atomic.LoadInt32(&calls))
+	}
+
+	state(CircuitOpen)
+
+	// A successful probe closes it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(cooldown)
+	state(CircuitHalfOpen)
+
+	if _, err := myapi.Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	state(CircuitClosed)
+
+	if _, err := myapi.Query("okdomain.org"); err != nil || atomic.LoadInt32(&calls) != 5 {
+		t.Errorf("err = %v after %d requests, want queries to go through", err, atomic.LoadInt32(&calls))
+	}
+}
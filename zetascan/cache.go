@@ -0,0 +1,330 @@
+package zetascan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of results kept by WithCache
+const DefaultCacheSize = 10000
+
+// CacheStats counts the lookups answered by the cache, see WithCache
+type CacheStats struct {
+	// PositiveHits were answered with a listed (black or white) result
+	PositiveHits int64
+	// NegativeHits were answered with a clean (not found) result
+	NegativeHits int64
+	// Misses went to the network, the item was not cached or had expired
+	Misses int64
+	// Entries currently held, including expired ones not yet evicted
+	Entries int
+	// Refreshes of hot entries by the background refresher, and the failed ones
+	Refreshes       int64
+	RefreshFailures int64
+}
+
+// resultCache holds query results by lookup (see lookupKey), shared by copies of an Api
+type resultCache struct {
+	sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]cacheEntry
+	stats       CacheStats
+
+	// The background refresher, see Start
+	stop context.CancelFunc
+	done chan struct{}
+
+	// Set by Close, nothing is cached any more
+	closed bool
+}
+
+// cacheEntry is a cached result and when it expires
+type cacheEntry struct {
+	record   JsonRecord
+	negative bool
+	expires  time.Time
+	hits     int
+
+	// The copy of the Api and the item queried, for the refresher
+	api   Api
+	query string
+}
+
+// WithCache returns a copy of the Api caching query results in memory: listed results for ttl
+// and clean (not found) results for negativeTTL, typically longer as clean items rarely change.
+// A zero TTL disables caching of that kind. Only successful lookups are cached, and copies of the
+// returned Api share the cache. The receiver is not modified.
+func (myapi Api) WithCache(ttl, negativeTTL time.Duration) Api {
+
+	myapi.cache = &resultCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]cacheEntry),
+	}
+
+	return myapi
+}
+
+// CacheStats returns the hit and miss counters of the cache configured via WithCache
+func (myapi Api) CacheStats() CacheStats {
+
+	if myapi.cache == nil {
+		return CacheStats{}
+	}
+
+	myapi.cache.Lock()
+	defer myapi.cache.Unlock()
+
+	stats := myapi.cache.stats
+	stats.Entries = len(myapi.cache.entries)
+
+	return stats
+}
+
+// get returns a fresh cached result for key
+func (cache *resultCache) get(key string) (JsonRecord, bool) {
+
+	if cache == nil {
+		return JsonRecord{}, false
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	entry, ok := cache.entries[key]
+
+	if ok == false || time.Now().After(entry.expires) {
+		delete(cache.entries, key)
+		cache.stats.Misses++
+		return JsonRecord{}, false
+	}
+
+	if entry.negative {
+		cache.stats.NegativeHits++
+	} else {
+		cache.stats.PositiveHits++
+	}
+
+	entry.hits++
+	cache.entries[key] = entry
+
+	// Give each caller its own Results slice
+	record := entry.record
+	record.Results = append(JsonResults(nil), record.Results...)
+
+	return record, true
+}
+
+// put caches record for key with the TTL of its kind, as queried by api for query
+func (cache *resultCache) put(key string, record JsonRecord, api Api, query string) {
+
+	if cache == nil {
+		return
+	}
+
+	negative := len(record.Results) > 0 && record.Results[0].Found == false && record.Results[0].Wl == false
+
+	ttl := cache.ttl
+
+	if negative {
+		ttl = cache.negativeTTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	record.Results = append(JsonResults(nil), record.Results...)
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.closed {
+		return
+	}
+
+	// Full? Make room by evicting the expired entries, otherwise skip caching. Replacing an entry
+	// (e.g. a refresh) needs no room.
+	if _, ok := cache.entries[key]; ok == false && len(cache.entries) >= DefaultCacheSize {
+		cache.evictExpired()
+
+		if len(cache.entries) >= DefaultCacheSize {
+			return
+		}
+	}
+
+	cache.entries[key] = cacheEntry{record: record, negative: negative, expires: time.Now().Add(ttl), api: api, query: query}
+}
+
+// close drops every entry and stops caching, see Api.Close
+func (cache *resultCache) close() {
+
+	if cache == nil {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.entries = make(map[string]cacheEntry)
+	cache.closed = true
+}
+
+// evictExpired removes the expired entries, the caller holds the lock
+func (cache *resultCache) evictExpired() {
+
+	now := time.Now()
+
+	for key, entry := range cache.entries {
+		if now.After(entry.expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// refreshInterval is the lower bound on how often the refresher scans the cache
+const refreshInterval = 100 * time.Millisecond
+
+// WithCacheRefresh returns a copy of the Api whose Start refreshes hot cache entries in the
+// background: entries hit at least threshold times since they were cached are queried again
+// within ahead of their expiry, so lookups for them never wait on the network. Requires WithCache.
+// The receiver is not modified.
+func (myapi Api) WithCacheRefresh(threshold int, ahead time.Duration) Api {
+
+	myapi.refreshHot = threshold
+	myapi.refreshAhead = ahead
+
+	return myapi
+}
+
+// Start runs the background cache refresher configured via WithCacheRefresh until ctx is done or
+// Stop is called. A failed refresh keeps the cached result until it expires.
+func (myapi Api) Start(ctx context.Context) error {
+
+	if myapi.isClosed() {
+		return ErrClosed
+	}
+
+	if myapi.cache == nil {
+		return errors.New("cache refresh requires WithCache")
+	}
+
+	if myapi.refreshHot < 1 || myapi.refreshAhead <= 0 {
+		return errors.New("cache refresh requires WithCacheRefresh")
+	}
+
+	myapi.cache.Lock()
+	defer myapi.cache.Unlock()
+
+	if myapi.cache.closed {
+		return ErrClosed
+	}
+
+	if myapi.cache.stop != nil {
+		return errors.New("cache refresh already started")
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	myapi.cache.stop, myapi.cache.done = stop, done
+
+	go func() {
+		defer close(done)
+		myapi.refresh(ctx)
+	}()
+
+	return nil
+}
+
+// Stop stops the background cache refresher and waits for it to exit
+func (myapi Api) Stop() {
+
+	if myapi.cache == nil {
+		return
+	}
+
+	myapi.cache.Lock()
+	stop, done := myapi.cache.stop, myapi.cache.done
+	myapi.cache.stop, myapi.cache.done = nil, nil
+	myapi.cache.Unlock()
+
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// refresh queries the hot entries close to expiry again, until ctx is done
+func (myapi Api) refresh(ctx context.Context) {
+
+	interval := myapi.refreshAhead / 2
+
+	if interval < refreshInterval {
+		interval = refreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for key, entry := range myapi.cache.hot(myapi.refreshHot, myapi.refreshAhead) {
+
+			// Refresh with the copy of the Api the entry was cached by
+			m, err := entry.api.lookup(ctx, key, entry.query)
+
+			if err != nil {
+				myapi.cache.refreshed(false)
+				continue
+			}
+
+			entry.api.reverseDNS(ctx, entry.query, &m)
+			myapi.cache.put(key, m, entry.api, entry.query)
+			myapi.cache.refreshed(true)
+
+		}
+
+	}
+}
+
+// hot returns the entries hit at least threshold times and expiring within ahead, by key
+func (cache *resultCache) hot(threshold int, ahead time.Duration) map[string]cacheEntry {
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	entries := make(map[string]cacheEntry)
+
+	now := time.Now()
+
+	for key, entry := range cache.entries {
+		if entry.hits >= threshold && now.Before(entry.expires) && entry.expires.Sub(now) <= ahead {
+			entries[key] = entry
+		}
+	}
+
+	return entries
+}
+
+// refreshed counts a background refresh
+func (cache *resultCache) refreshed(ok bool) {
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.stats.Refreshes++
+
+	if ok == false {
+		cache.stats.RefreshFailures++
+	}
+}
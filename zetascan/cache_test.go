@@ -0,0 +1,156 @@
+package zetascan
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// subnetHandler lists 127.9.9.1 only by its subnet, when queried with subnet=1
+func subnetHandler(calls *int32) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		atomic.AddInt32(calls, 1)
+
+		if r.URL.Query().Get("subnet") == "1" {
+			fmt.Fprint(w, `{"results":[{"item":"127.9.9.1","found":true,"score":0.8,"fromSubnet":true,"sources":["shXBL"]}],"status":"success"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"results":[{"item":"127.9.9.1","found":false,"score":0}],"status":"notfound"}`)
+	}
+}
+
+func TestCacheKeyedByConfiguration(t *testing.T) {
+
+	var calls int32
+
+	myapi := newTestApi(t, httptest.NewTLSServer(subnetHandler(&calls)))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithCache(time.Minute, time.Minute).WithSubnetLookup(true)
+
+	for i := 0; i < 2; i++ {
+		if m, err := myapi.Query("127.9.9.1"); err != nil || m.Results[0].Found == false {
+			t.Fatalf("subnet lookup = %+v, %v", m, err)
+		}
+	}
+
+	// The exact-IP copy shares the cache but not the subnet verdict
+	exact := myapi.WithSubnetLookup(false)
+
+	for i := 0; i < 2; i++ {
+		if m, err := exact.Query("127.9.9.1"); err != nil || m.Results[0].Found {
+			t.Fatalf("exact lookup = %+v, %v", m, err)
+		}
+	}
+
+	// Another method doesn't share it either
+	jsonx := myapi
+	jsonx.ApiMethod = "jsonx"
+
+	if _, err := jsonx.Query("127.9.9.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+
+	stats := myapi.CacheStats()
+
+	if stats.PositiveHits != 1 || stats.NegativeHits != 1 || stats.Misses != 3 || stats.Entries != 3 {
+		t.Errorf("stats = %+v, want 1 positive and 1 negative hit, 3 misses and entries", stats)
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+
+	myapi, _ := Api{}.Init(testKey, false)
+
+	dnsapi := myapi
+	dnsapi.ApiMethod = "dns"
+
+	zone := dnsapi
+	zone.DnsZone = "zen.example"
+
+	txt := dnsapi
+	txt.DnsType = "TXT"
+
+	server := dnsapi
+	server.DnsEndpoint = "127.0.0.1:5353"
+
+	endpoint, _ := myapi.WithEndpoint("api.example.com")
+	rekeyed, _ := Api{}.Init("OTHERKEY", false)
+
+	apis := map[string]Api{
+		"http":         myapi,
+		"subnet":       myapi.WithSubnetLookup(true),
+		"endpoint":     endpoint,
+		"key":          rekeyed,
+		"reverse dns":  myapi.WithReverseDNS(nil),
+		"dns":          dnsapi,
+		"dns zone":     zone,
+		"dns txt":      txt,
+		"dns endpoint": server,
+	}
+
+	seen := make(map[string]string)
+
+	for name, api := range apis {
+
+		key := api.lookupKey("127.9.9.1")
+
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s share the lookup key %q", name, other, key)
+		}
+
+		seen[key] = name
+	}
+
+	// Domain queries don't send the subnet parameter
+	if myapi.lookupKey("baddomain.org") != myapi.WithSubnetLookup(true).lookupKey("baddomain.org") {
+		t.Error("subnet lookups change the key of a domain query")
+	}
+}
+
+func TestCacheRefreshKeepsConfiguration(t *testing.T) {
+
+	var calls int32
+
+	myapi := newTestApi(t, httptest.NewTLSServer(subnetHandler(&calls)))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithCache(time.Second, time.Second).WithCacheRefresh(1, time.Second)
+
+	// Cached by a subnet copy, refreshed by the Api that started the refresher
+	subnet := myapi.WithSubnetLookup(true)
+
+	for i := 0; i < 2; i++ {
+		if _, err := subnet.Query("127.9.9.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := myapi.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer myapi.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for myapi.CacheStats().Refreshes == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := myapi.CacheStats(); stats.Refreshes == 0 || stats.RefreshFailures != 0 {
+		t.Fatalf("stats = %+v, want a successful refresh", stats)
+	}
+
+	if m, err := subnet.Query("127.9.9.1"); err != nil || m.Results[0].Found == false {
+		t.Errorf("refreshed subnet lookup = %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,459 @@
+package zetascan
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/proxy"
+)
+
+// SetUserAgent sets the User-Agent sent with every outbound request
+func (myapi *Api) SetUserAgent(userAgent string) {
+	myapi.UserAgent = userAgent
+}
+
+// SetHeader sets a header sent with every outbound request, replacing any previous value for key
+func (myapi *Api) SetHeader(key, value string) {
+
+	// Copy on write, copies of this Api may still be querying with the old headers
+	headers := myapi.headers.Clone()
+
+	if headers == nil {
+		headers = http.Header{}
+	}
+
+	headers.Set(key, value)
+	myapi.headers = headers
+}
+
+// newRequest builds an outbound request carrying the configured User-Agent and headers
+func (myapi Api) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range myapi.headers {
+		req.Header[key] = values
+	}
+
+	if myapi.UserAgent != "" {
+		req.Header.Set("User-Agent", myapi.UserAgent)
+	}
+
+	// Propagate the query span, see WithTracer
+	if myapi.tracer != nil {
+		myapi.tracer.Inject(ctx, req.Header)
+	}
+
+	return req, nil
+}
+
+// DefaultAuthHeader carries the API key when header auth is enabled without a header name
+const DefaultAuthHeader = "X-API-Key"
+
+// WithHeaderAuth returns a copy of the Api that sends the API key in header (DefaultAuthHeader if
+// empty) instead of the key query parameter, keeping it out of access and proxy logs.
+// The receiver is not modified.
+func (myapi Api) WithHeaderAuth(header string) Api {
+
+	if header == "" {
+		header = DefaultAuthHeader
+	}
+
+	myapi.authHeader = http.CanonicalHeaderKey(header)
+
+	return myapi
+}
+
+// methodContentTypes is the Accept header sent per method, the http method answers in headers
+var methodContentTypes = map[string]string{
+	"text":  "text/plain",
+	"json":  "application/json",
+	"jsonx": "application/json",
+	"xml":   "application/xml",
+}
+
+// newQueryRequest builds the lookup request for query, with the API key in the URL or auth header
+func (myapi Api) newQueryRequest(ctx context.Context, query string) (*http.Request, error) {
+
+	req, err := myapi.newRequest(ctx, "GET", myapi.getUrl(query), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Client certificates replace the key, as in getUrl
+	if myapi.authHeader != "" && myapi.apiKey != "" && myapi.mutualTLS() == false {
+		req.Header.Set(myapi.authHeader, myapi.apiKey)
+	}
+
+	// Ask for the format of the method, unless set via SetHeader
+	if accept := methodContentTypes[myapi.ApiMethod]; accept != "" && req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	return req, nil
+}
+
+// WithTLSConfig returns a copy of the Api whose HTTPS requests (including DoH) use cfg, e.g. to
+// pin the provider's CA via RootCAs, trust an internal mirror or present client certificates.
+// The receiver is not modified.
+func (myapi Api) WithTLSConfig(cfg *tls.Config) Api {
+
+	myapi.tlsConfig = cfg.Clone()
+	myapi.client = myapi.buildClient()
+
+	return myapi
+}
+
+// WithInsecureSkipVerify returns a copy of the Api that skips (or restores) server certificate
+// verification. Only use this against test environments: with verification disabled any
+// machine-in-the-middle can read the API key and forge verdicts.
+func (myapi Api) WithInsecureSkipVerify(skip bool) Api {
+
+	cfg := myapi.tlsConfig.Clone()
+
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	cfg.InsecureSkipVerify = skip
+
+	return myapi.WithTLSConfig(cfg)
+}
+
+// WithClientCertificate returns a copy of the Api presenting cert on every HTTPS request (mutual
+// TLS). Client certificates replace the API key, which is then no longer added to the URL.
+func (myapi Api) WithClientCertificate(cert tls.Certificate) Api {
+
+	cfg := myapi.tlsConfig.Clone()
+
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	cfg.Certificates = append(cfg.Certificates, cert)
+
+	return myapi.WithTLSConfig(cfg)
+}
+
+// mutualTLS reports if client certificates are configured for authentication
+func (myapi Api) mutualTLS() bool {
+
+	if myapi.tlsConfig == nil {
+		return false
+	}
+
+	return len(myapi.tlsConfig.Certificates) > 0 || myapi.tlsConfig.GetClientCertificate != nil
+}
+
+// buildClient returns a client for the transport options, nil when the defaults apply (http.DefaultClient,
+// which already negotiates HTTP/2 over https)
+func (myapi Api) buildClient() *http.Client {
+
+	if myapi.tlsConfig == nil && myapi.proxyURL == nil {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = myapi.tlsConfig
+
+	// A custom TLS config disables HTTP/2 unless forced, keep multiplexing lookups over one connection
+	transport.ForceAttemptHTTP2 = true
+
+	// A SOCKS5 proxy dials every connection, an HTTP(S) proxy is used by the transport. Otherwise the
+	// cloned transport keeps http.ProxyFromEnvironment.
+	if myapi.proxyDial != nil {
+		transport.Proxy = nil
+		transport.DialContext = myapi.proxyDial
+	} else if myapi.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(myapi.proxyURL)
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// WithProxy returns a copy of the Api sending its HTTP requests (including DoH) through the proxy
+// at proxyURL: http:// or https:// for an HTTP proxy, socks5:// (or socks5h://) for SOCKS5, with
+// optional user:password. Nameserver DNS lookups are not proxied. Without WithProxy the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply (http.ProxyFromEnvironment, as
+// with the default transport), except with WithHTTPClient. The receiver is not modified.
+func (myapi Api) WithProxy(proxyURL string) (Api, error) {
+
+	u, err := url.Parse(proxyURL)
+
+	if err != nil {
+		return myapi, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	if u.Host == "" {
+		return myapi, fmt.Errorf("invalid proxy URL %q: no host", proxyURL)
+	}
+
+	myapi.proxyURL, myapi.proxyDial = u, nil
+
+	switch u.Scheme {
+	case "http", "https":
+
+	case "socks5", "socks5h":
+
+		dialer, err := proxy.FromURL(u, proxy.Direct)
+
+		if err != nil {
+			return myapi, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+
+		if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+			myapi.proxyDial = contextDialer.DialContext
+		} else {
+			myapi.proxyDial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			}
+		}
+
+	default:
+		return myapi, fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", u.Scheme)
+	}
+
+	myapi.client = myapi.buildClient()
+
+	return myapi, nil
+}
+
+// WithHTTPClient returns a copy of the Api sending every HTTP request (including DoH) with client.
+// The client is used as-is: configure TLS, proxies (environment variables included), compression and HTTP/2 (e.g. an http2.Transport,
+// or ForceAttemptHTTP2 with a custom TLS config) on its transport, the transport options of this
+// package (WithTLSConfig, ...) don't apply to it. The User-Agent, headers, key redaction and
+// decompression still apply.
+func (myapi Api) WithHTTPClient(client *http.Client) Api {
+
+	myapi.customClient = client
+
+	return myapi
+}
+
+// httpClient returns the client outbound requests are sent with
+func (myapi Api) httpClient() *http.Client {
+
+	if myapi.customClient != nil {
+		return myapi.customClient
+	}
+
+	if myapi.client != nil {
+		return myapi.client
+	}
+
+	return http.DefaultClient
+}
+
+// compression reports if responses may be compressed, false when the transport disables it
+func (myapi Api) compression() bool {
+
+	transport := myapi.httpClient().Transport
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if t, ok := transport.(*http.Transport); ok && t.DisableCompression {
+		return false
+	}
+
+	return true
+}
+
+// do sends an outbound request with the configured client, asking for a gzip or deflate
+// compressed response which is transparently decompressed
+func (myapi Api) do(req *http.Request) (*http.Response, error) {
+
+	compress := myapi.compression() && req.Header.Get("Accept-Encoding") == ""
+
+	if compress {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	res, err := myapi.httpClient().Do(req)
+
+	if myapi.Debug {
+		myapi.recordExchange(req, res)
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	// Decode even when compression wasn't asked for, a server may compress regardless
+	if err := decompress(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// decompress replaces a gzip or deflate encoded response body with its decoded content
+func decompress(res *http.Response) error {
+
+	var reader io.ReadCloser
+	var err error
+
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+
+	// No encoding declared? A gzip body is still recognized by its magic number, a reputation
+	// response never starts with it
+	if encoding == "" {
+
+		buffered := bufio.NewReader(res.Body)
+		res.Body = &decodedBody{ReadCloser: ioutil.NopCloser(buffered), raw: res.Body}
+
+		if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			encoding = "gzip"
+		}
+
+	}
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(res.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(res.Body)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	res.Body = &decodedBody{ReadCloser: reader, raw: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return nil
+}
+
+// decodedBody closes both the decoder and the raw response body
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (body *decodedBody) Close() error {
+
+	body.ReadCloser.Close()
+
+	return body.raw.Close()
+}
+
+// Exchange is a raw dump of an HTTP request/response pair, see LastExchange
+type Exchange struct {
+	// Request dump of the outbound request, the API key redacted
+	Request []byte
+	// Response dump of the raw response including the body (up to MaxBodySize), nil if no response
+	// was received
+	Response []byte
+}
+
+// exchangeLog holds the last Exchange, shared by copies of an Api
+type exchangeLog struct {
+	sync.Mutex
+	last *Exchange
+}
+
+// LastExchange returns the last HTTP exchange recorded while Debug was set, false if none
+func (myapi Api) LastExchange() (Exchange, bool) {
+
+	if myapi.exchanges == nil {
+		return Exchange{}, false
+	}
+
+	myapi.exchanges.Lock()
+	defer myapi.exchanges.Unlock()
+
+	if myapi.exchanges.last == nil {
+		return Exchange{}, false
+	}
+
+	return *myapi.exchanges.last, true
+}
+
+// recordExchange dumps the request and response as the last exchange
+func (myapi Api) recordExchange(req *http.Request, res *http.Response) {
+
+	if myapi.exchanges == nil {
+		return
+	}
+
+	// Redact the key before dumping
+	masked := req.Clone(req.Context())
+	masked.URL = redactURL(req.URL)
+	masked.Body = nil
+
+	masked.Header = myapi.redactHeader(req.Header)
+
+	exchange := &Exchange{}
+	exchange.Request, _ = httputil.DumpRequestOut(masked, false)
+
+	// Buffer at most MaxBodySize (plus the byte readBody needs to detect an oversized body), then
+	// put it back in front of the rest so the response remains readable
+	if res != nil {
+
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, myapi.bodyLimit()+1))
+		res.Body = &decodedBody{ReadCloser: ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), res.Body)), raw: res.Body}
+
+		if int64(len(body)) > myapi.bodyLimit() {
+			body = body[:myapi.bodyLimit()]
+		}
+
+		exchange.Response, _ = httputil.DumpResponse(res, false)
+		exchange.Response = append(exchange.Response, body...)
+	}
+
+	myapi.exchanges.Lock()
+	myapi.exchanges.last = exchange
+	myapi.exchanges.Unlock()
+}
+
+// redactHeader returns a copy of header with the value of the auth header replaced, see WithHeaderAuth
+func (myapi Api) redactHeader(header http.Header) http.Header {
+
+	redacted := header.Clone()
+
+	if myapi.authHeader != "" && redacted.Get(myapi.authHeader) != "" {
+		redacted.Set(myapi.authHeader, "REDACTED")
+	}
+
+	return redacted
+}
+
+// redactURL returns a copy of u with the value of the key parameter replaced
+func redactURL(u *url.URL) *url.URL {
+
+	redacted := *u
+	values := redacted.Query()
+
+	if values.Get("key") != "" {
+		values.Set("key", "REDACTED")
+		redacted.RawQuery = values.Encode()
+	}
+
+	return &redacted
+}
@@ -0,0 +1,662 @@
+package zetascan
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// headerHandler records the headers of the last request, answering like listedHandler
+func headerHandler(headers *http.Header, listed ...string) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		*headers = r.Header.Clone()
+		listedHandler(listed...)(w, r)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+
+	var headers http.Header
+
+	myapi := newTestApi(t, httptest.NewTLSServer(headerHandler(&headers)))
+	myapi.ApiMethod = "json"
+	myapi.SetUserAgent("mailfilter/1.0")
+	myapi.SetHeader("X-Client-Id", "mx1")
+
+	if _, err := myapi.Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headers.Get("User-Agent"); got != "mailfilter/1.0" {
+		t.Errorf("User-Agent = %q, want mailfilter/1.0", got)
+	}
+
+	if got := headers.Get("X-Client-Id"); got != "mx1" {
+		t.Errorf("X-Client-Id = %q, want mx1", got)
+	}
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+
+	var headers http.Header
+
+	myapi := newTestApi(t, httptest.NewTLSServer(headerHandler(&headers)))
+	myapi.ApiMethod = "json"
+
+	if _, err := myapi.Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headers.Get("User-Agent"); got != "go-zetascan/2" {
+		t.Errorf("User-Agent = %q, want go-zetascan/2", got)
+	}
+}
+
+func TestHeaderAuth(t *testing.T) {
+
+	var headers http.Header
+	var rawQuery string
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		headerHandler(&headers)(w, r)
+	})))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithHeaderAuth("")
+
+	if _, err := myapi.Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(rawQuery, "key=") || strings.Contains(rawQuery, testKey) {
+		t.Errorf("query string %q carries the key", rawQuery)
+	}
+
+	if got := headers.Get("X-API-Key"); got != testKey {
+		t.Errorf("X-API-Key = %q, want %q", got, testKey)
+	}
+}
+
+func TestAcceptHeader(t *testing.T) {
+
+	var headers http.Header
+
+	myapi := newTestApi(t, httptest.NewTLSServer(headerHandler(&headers)))
+
+	tests := []struct {
+		method string
+		accept string
+	}{
+		{"json", "application/json"},
+		{"jsonx", "application/json"},
+		{"text", "text/plain"},
+		{"xml", "application/xml"},
+		{"http", ""},
+	}
+
+	for _, test := range tests {
+
+		myapi.ApiMethod = test.method
+
+		// The mock answers json whatever the method, only the request matters
+		myapi.Query("okdomain.org")
+
+		if got := headers.Get("Accept"); got != test.accept {
+			t.Errorf("%s: Accept = %q, want %q", test.method, got, test.accept)
+		}
+	}
+
+	// SetHeader overrides it
+	myapi.ApiMethod = "json"
+	myapi.SetHeader("Accept", "application/vnd.zetascan+json")
+
+	if _, err := myapi.Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headers.Get("Accept"); got != "application/vnd.zetascan+json" {
+		t.Errorf("Accept = %q, want the SetHeader value", got)
+	}
+}
+
+// testClientCertificate returns a self-signed client certificate
+func testClientCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "zetascan client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
+func TestMutualTLS(t *testing.T) {
+
+	cert, leaf := testClientCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	var rawQuery string
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		listedHandler("baddomain.org")(w, r)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	myapi, err := Api{}.Init(testKey, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if myapi, err = myapi.WithEndpoint(strings.TrimPrefix(server.URL, "https://")); err != nil {
+		t.Fatal(err)
+	}
+
+	myapi.ApiMethod = "json"
+
+	// Without the certificate the server refuses the handshake
+	if _, err := myapi.WithTLSConfig(&tls.Config{RootCAs: rootCAs}).Query("baddomain.org"); err == nil {
+		t.Fatal("query without a client certificate succeeded")
+	}
+
+	myapi = myapi.WithTLSConfig(&tls.Config{RootCAs: rootCAs}).WithClientCertificate(cert)
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Results[0].Found == false {
+		t.Errorf("unexpected record %+v", m)
+	}
+
+	if strings.Contains(rawQuery, "key=") {
+		t.Errorf("query %q carries the API key with mutual TLS", rawQuery)
+	}
+
+	// The key is never sent, plain http no longer leaks it
+	if _, err := myapi.WithSSL(false); err != nil {
+		t.Errorf("WithSSL(false) with a client certificate: %v", err)
+	}
+}
+
+func TestLastExchangeRedactsKey(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("baddomain.org")))
+	myapi.ApiMethod = "json"
+	myapi.Debug = true
+
+	if _, err := myapi.Query("baddomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange, ok := myapi.LastExchange()
+
+	if ok == false {
+		t.Fatal("no exchange recorded")
+	}
+
+	if strings.Contains(string(exchange.Request), testKey) || strings.Contains(string(exchange.Request), "key=REDACTED") == false {
+		t.Errorf("request dump doesn't redact the key:\n%s", exchange.Request)
+	}
+
+	if strings.Contains(string(exchange.Response), `"item":"baddomain.org"`) == false {
+		t.Errorf("response dump lacks the body:\n%s", exchange.Response)
+	}
+
+	// Header auth moves the key, it is redacted there too
+	if _, err := myapi.WithHeaderAuth("").Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange, _ = myapi.LastExchange()
+
+	if strings.Contains(string(exchange.Request), testKey) || strings.Contains(string(exchange.Request), "X-Api-Key: REDACTED") == false {
+		t.Errorf("request dump doesn't redact the auth header:\n%s", exchange.Request)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+
+	protos := make(chan int, 2)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		protos <- r.ProtoMajor
+
+		if strings.HasSuffix(r.URL.Path, "/forbidden.example") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		listedHandler("baddomain.org")(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+
+	myapi := newTestApi(t, server)
+	myapi.ApiMethod = "json"
+	myapi.Debug = true
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proto := <-protos; proto != 2 {
+		t.Errorf("request over HTTP/%d, want HTTP/2", proto)
+	}
+
+	if m.Results[0].Found == false {
+		t.Errorf("unexpected record %+v", m)
+	}
+
+	if exchange, _ := myapi.LastExchange(); strings.Contains(string(exchange.Request), testKey) || strings.Contains(string(exchange.Request), "key=REDACTED") == false {
+		t.Errorf("request dump doesn't redact the key:\n%s", exchange.Request)
+	}
+
+	_, err = myapi.Query("forbidden.example")
+
+	if <-protos != 2 || errors.Is(err, ErrForbidden) == false || strings.Contains(err.Error(), testKey) {
+		t.Errorf("err = %v, want a redacted ErrForbidden over HTTP/2", err)
+	}
+}
+
+func TestDebugKeepsBodyLimit(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"item":"` + strings.Repeat("a", 4096) + `"}]}`))
+	})))
+	myapi.ApiMethod = "json"
+	myapi.MaxBodySize = 1024
+	myapi.Debug = true
+
+	if _, err := myapi.Query("baddomain.org"); errors.Is(err, ErrBodyTooLarge) == false {
+		t.Errorf("err = %v, want ErrBodyTooLarge", err)
+	}
+
+	exchange, _ := myapi.LastExchange()
+
+	// The headers and at most 1024 bytes of the 4KB body
+	if len(exchange.Response) > 2048 {
+		t.Errorf("response dump holds more than MaxBodySize: %d bytes", len(exchange.Response))
+	}
+}
+
+// gzipped compresses body
+func gzipped(body string) []byte {
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(body))
+	writer.Close()
+
+	return buf.Bytes()
+}
+
+func TestGzipResponse(t *testing.T) {
+
+	var acceptEncoding string
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+
+		if strings.Contains(acceptEncoding, "gzip") == false {
+			listedHandler("baddomain.org")(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped(`{"results":[{"item":"baddomain.org","found":true,"score":1,"sources":["dbl"]}],"status":"success"}`))
+	})))
+	myapi.ApiMethod = "json"
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(acceptEncoding, "gzip") == false {
+		t.Errorf("Accept-Encoding = %q, want gzip", acceptEncoding)
+	}
+
+	if m.Results[0].Item != "baddomain.org" || m.Results[0].Found == false {
+		t.Errorf("unexpected record %+v", m)
+	}
+
+	// A client with compression disabled doesn't ask for it
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = myapi.httpClient().Transport.(*http.Transport).TLSClientConfig
+	transport.DisableCompression = true
+
+	if _, err := myapi.WithHTTPClient(&http.Client{Transport: transport}).Query("okdomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if acceptEncoding != "" {
+		t.Errorf("Accept-Encoding = %q with compression disabled", acceptEncoding)
+	}
+}
+
+func TestGzipAlways(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped(`{"results":[{"item":"baddomain.org","found":true,"score":1,"sources":["dbl"]}],"status":"success"}`))
+	})))
+	myapi.ApiMethod = "json"
+
+	// Without compression the transport leaves the body to the client to decode
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = myapi.httpClient().Transport.(*http.Transport).TLSClientConfig
+	transport.DisableCompression = true
+
+	for name, api := range map[string]Api{"default": myapi, "compression disabled": myapi.WithHTTPClient(&http.Client{Transport: transport})} {
+
+		m, err := api.Query("baddomain.org")
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if m.Results[0].Item != "baddomain.org" || m.Results[0].Found == false || m.Results[0].Sources[0] != "dbl" {
+			t.Errorf("%s: unexpected record %+v", name, m)
+		}
+	}
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+
+	// http.ProxyFromEnvironment reads the environment once per process, check in a fresh one
+	if os.Getenv("ZETASCAN_TEST_PROXY_CHILD") != "1" {
+
+		cmd := exec.Command(os.Args[0], "-test.run=^TestProxyFromEnvironment$")
+		cmd.Env = append(os.Environ(), "ZETASCAN_TEST_PROXY_CHILD=1")
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+
+		return
+	}
+
+	connects := make(chan string, 2)
+
+	// The proxy records the tunnels asked for and refuses them
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method == http.MethodConnect {
+			connects <- r.Host
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	// Proxies are skipped for localhost, query a name the proxy would resolve
+	myapi, _ := Api{}.Init(testKey, false)
+	myapi, _ = myapi.WithEndpoint("zetascan.test")
+
+	for name, api := range map[string]Api{"default": myapi, "tls config": myapi.WithTLSConfig(&tls.Config{})} {
+
+		if _, err := api.Query("baddomain.org"); err == nil {
+			t.Errorf("%s: query through a refusing proxy succeeded", name)
+		}
+
+		select {
+		case host := <-connects:
+			if host != "zetascan.test:443" {
+				t.Errorf("%s: CONNECT %s, want zetascan.test:443", name, host)
+			}
+		default:
+			t.Errorf("%s: request not sent through HTTPS_PROXY", name)
+		}
+	}
+}
+
+// proxyApi returns an Api for server trusting its certificate, sending its queries through proxyURL
+func proxyApi(t *testing.T, server *httptest.Server, proxyURL string) Api {
+
+	t.Helper()
+	t.Cleanup(server.Close)
+
+	myapi, _ := Api{}.Init(testKey, false)
+	myapi, _ = myapi.WithEndpoint(strings.TrimPrefix(server.URL, "https://"))
+	myapi.ApiMethod = "json"
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	myapi, err := myapi.WithTLSConfig(&tls.Config{RootCAs: roots}).WithProxy(proxyURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(myapi.client.CloseIdleConnections)
+
+	return myapi
+}
+
+// pipe copies between the two connections until either side closes
+func pipe(a, b net.Conn) {
+
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+
+	io.Copy(b, a)
+	b.Close()
+}
+
+func TestWithProxyHTTP(t *testing.T) {
+
+	connects := make(chan string, 1)
+
+	// The proxy records the tunnels asked for and opens them
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+
+		if err != nil {
+			upstream.Close()
+			return
+		}
+
+		connects <- r.Host
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		pipe(conn, upstream)
+	}))
+	defer proxy.Close()
+
+	server := httptest.NewTLSServer(listedHandler("baddomain.org"))
+	myapi := proxyApi(t, server, proxy.URL)
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Results[0].Found == false {
+		t.Errorf("record %+v, want found", m)
+	}
+
+	select {
+	case host := <-connects:
+		if host != server.Listener.Addr().String() {
+			t.Errorf("CONNECT %s, want %s", host, server.Listener.Addr())
+		}
+	default:
+		t.Error("request not sent through the proxy")
+	}
+}
+
+func TestWithProxySOCKS5(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	connects := make(chan string, 1)
+
+	// A minimal SOCKS5 server: no authentication, CONNECT to an IPv4 address
+	go func() {
+
+		for {
+
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+
+				defer conn.Close()
+
+				buf := make([]byte, 262)
+
+				// Greeting: version, methods
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 5 {
+					return
+				}
+
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+
+				conn.Write([]byte{5, 0})
+
+				// Request: version, CONNECT, reserved, IPv4, address, port
+				if _, err := io.ReadFull(conn, buf[:10]); err != nil || buf[1] != 1 || buf[3] != 1 {
+					conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+
+				addr := net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(buf[8])<<8|int(buf[9])))
+
+				upstream, err := net.Dial("tcp", addr)
+
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+
+				connects <- addr
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				pipe(conn, upstream)
+			}()
+		}
+	}()
+
+	server := httptest.NewTLSServer(listedHandler("baddomain.org"))
+	myapi := proxyApi(t, server, "socks5://"+listener.Addr().String())
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Results[0].Found == false {
+		t.Errorf("record %+v, want found", m)
+	}
+
+	select {
+	case addr := <-connects:
+		if addr != server.Listener.Addr().String() {
+			t.Errorf("SOCKS5 CONNECT %s, want %s", addr, server.Listener.Addr())
+		}
+	default:
+		t.Error("request not sent through the proxy")
+	}
+}
+
+func TestWithProxyInvalid(t *testing.T) {
+
+	for _, proxyURL := range []string{"ftp://proxy.example:21", "proxy.example:3128", "http://", "://proxy.example", "http://proxy example:3128"} {
+		if _, err := (Api{}).WithProxy(proxyURL); err == nil {
+			t.Errorf("WithProxy(%q) succeeded", proxyURL)
+		}
+	}
+}
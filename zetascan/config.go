@@ -0,0 +1,86 @@
+package zetascan
+
+import (
+	"strings"
+	"time"
+)
+
+// Config is a read-only snapshot of the effective settings of an Api, see Api.Config
+type Config struct {
+	// Key is the API key masked to its last four characters, empty when unset
+	Key        string
+	KeyCount   int
+	IPAuth     bool
+	MutualTLS  bool
+	AuthHeader string
+
+	Endpoint string
+	Protocol string
+	Version  string
+	Method   string
+
+	DnsMethod string
+	DnsType   string
+	DnsServer string
+	DnsZone   string
+	DohURL    string
+
+	Timeout        time.Duration
+	MaxBodySize    int64
+	MaxQueryLength int
+	Concurrency    int
+	UserAgent      string
+	Dedupe         bool
+	Debug          bool
+}
+
+// Config returns the resolved configuration for logging and support tickets, with the key masked
+func (myapi Api) Config() Config {
+
+	config := Config{
+		Key:        maskKey(myapi.apiKey),
+		KeyCount:   1,
+		IPAuth:     myapi.ipAuth,
+		MutualTLS:  myapi.mutualTLS(),
+		AuthHeader: myapi.authHeader,
+
+		Endpoint: myapi.apiURL,
+		Protocol: myapi.apiProtocol,
+		Version:  myapi.apiVersion,
+		Method:   myapi.ApiMethod,
+
+		DnsMethod: myapi.DnsMethod,
+		DnsType:   myapi.DnsType,
+		DnsServer: myapi.dnsServer(),
+		DnsZone:   myapi.DnsZone,
+		DohURL:    myapi.DohURL,
+
+		Timeout:        myapi.Timeout,
+		MaxBodySize:    myapi.MaxBodySize,
+		MaxQueryLength: myapi.MaxQueryLength,
+		Concurrency:    myapi.workers(),
+		UserAgent:      myapi.UserAgent,
+		Dedupe:         myapi.Dedupe,
+		Debug:          myapi.Debug,
+	}
+
+	if myapi.apiKey == "" {
+		config.KeyCount = 0
+	}
+
+	if myapi.keys != nil {
+		config.KeyCount = len(myapi.keys.keys)
+	}
+
+	return config
+}
+
+// maskKey hides all but the last four characters of key
+func maskKey(key string) string {
+
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
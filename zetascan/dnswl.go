@@ -0,0 +1,109 @@
+package zetascan
+
+import (
+	"net"
+	"strconv"
+)
+
+// DNSWL answers are remapped from the DNSWL 127.0.C.T return codes to 127.8.C.T, as 127.0 is taken
+// by Spamhaus: C is the category of the listed sender and T its trust level
+
+// DNSWLTrust is the trust level of a DNSWL listing, from the last octet of the answer
+type DNSWLTrust int
+
+const (
+	TrustNone DNSWLTrust = iota
+	TrustLow
+	TrustMedium
+	TrustHigh
+)
+
+// String returns the DNSWL name of the trust level
+func (trust DNSWLTrust) String() string {
+
+	switch trust {
+	case TrustNone:
+		return "none"
+	case TrustLow:
+		return "low"
+	case TrustMedium:
+		return "medium"
+	case TrustHigh:
+		return "high"
+	}
+
+	return "unknown(" + strconv.Itoa(int(trust)) + ")"
+}
+
+// DNSWLCategory is the category of a DNSWL listing, from the third octet of the answer, 0 when the
+// answer carries none
+type DNSWLCategory int
+
+const (
+	DNSWLFinancial     DNSWLCategory = 2
+	DNSWLEmailProvider DNSWLCategory = 3
+	DNSWLOrganisation  DNSWLCategory = 4
+	DNSWLNetwork       DNSWLCategory = 5
+	DNSWLPersonal      DNSWLCategory = 6
+	DNSWLTravel        DNSWLCategory = 7
+	DNSWLPublicSector  DNSWLCategory = 8
+	DNSWLMedia         DNSWLCategory = 9
+	DNSWLSpecial       DNSWLCategory = 10
+	DNSWLEducation     DNSWLCategory = 11
+	DNSWLHealthcare    DNSWLCategory = 12
+	DNSWLManufacturing DNSWLCategory = 13
+	DNSWLRetail        DNSWLCategory = 14
+	DNSWLMarketing     DNSWLCategory = 15
+	DNSWLSelfService   DNSWLCategory = 20
+)
+
+var dnswlCategoryNames = map[DNSWLCategory]string{
+	DNSWLFinancial:     "financial",
+	DNSWLEmailProvider: "email",
+	DNSWLOrganisation:  "org",
+	DNSWLNetwork:       "network",
+	DNSWLPersonal:      "personal",
+	DNSWLTravel:        "travel",
+	DNSWLPublicSector:  "public",
+	DNSWLMedia:         "media",
+	DNSWLSpecial:       "special",
+	DNSWLEducation:     "education",
+	DNSWLHealthcare:    "healthcare",
+	DNSWLManufacturing: "manufacturing",
+	DNSWLRetail:        "retail",
+	DNSWLMarketing:     "marketing",
+	DNSWLSelfService:   "selfservice",
+}
+
+// String returns a short name of the category, e.g. financial or org
+func (category DNSWLCategory) String() string {
+
+	if name, ok := dnswlCategoryNames[category]; ok {
+		return name
+	}
+
+	if category == 0 {
+		return "none"
+	}
+
+	return "unknown(" + strconv.Itoa(int(category)) + ")"
+}
+
+// DNSWL is a decoded DNSWL answer, see JsonRecord.DNSWL
+type DNSWL struct {
+	Trust    DNSWLTrust    `json:"trust"`
+	Category DNSWLCategory `json:"category"`
+}
+
+// parseDNSWL decodes a 127.8.C.T answer, false if ip is not one. Whether it is a listing is up to
+// ParseDNS: only 127.8.0.x answers aren't a blacklist hit.
+func parseDNSWL(ip net.IP) (DNSWL, bool) {
+
+	ip4 := ip.To4()
+
+	if ip4 == nil || ip4[0] != 127 || ip4[1] != 8 {
+		return DNSWL{}, false
+	}
+
+	return DNSWL{Trust: DNSWLTrust(ip4[3]), Category: DNSWLCategory(ip4[2])}, true
+}
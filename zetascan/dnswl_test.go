@@ -0,0 +1,63 @@
+package zetascan
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseDNSWL(t *testing.T) {
+
+	tests := []struct {
+		answer string
+		dnswl  DNSWL
+		ok     bool
+	}{
+		{"127.8.2.0", DNSWL{TrustNone, DNSWLFinancial}, true},
+		{"127.8.3.1", DNSWL{TrustLow, DNSWLEmailProvider}, true},
+		{"127.8.4.2", DNSWL{TrustMedium, DNSWLOrganisation}, true},
+		{"127.8.11.3", DNSWL{TrustHigh, DNSWLEducation}, true},
+		{"127.8.0.4", DNSWL{DNSWLTrust(4), 0}, true},
+		{"127.8.2.4", DNSWL{DNSWLTrust(4), DNSWLFinancial}, true},
+		{"127.0.0.2", DNSWL{}, false},
+		{"2001:db8::1", DNSWL{}, false},
+	}
+
+	for _, test := range tests {
+		if dnswl, ok := parseDNSWL(net.ParseIP(test.answer)); dnswl != test.dnswl || ok != test.ok {
+			t.Errorf("parseDNSWL(%s) = %+v, %t, want %+v, %t", test.answer, dnswl, ok, test.dnswl, test.ok)
+		}
+	}
+}
+
+func TestParseDNSWLTrust(t *testing.T) {
+
+	// The highest trust of several answers wins
+	record, err := (Api{}).ParseDNS([]net.IP{net.ParseIP("127.8.3.1"), net.ParseIP("127.8.2.3"), net.ParseIP("127.8.4.0")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.DNSWL == nil || record.DNSWL.Trust != TrustHigh || record.DNSWL.Category != DNSWLFinancial {
+		t.Fatalf("DNSWL = %+v, want high trust financial", record.DNSWL)
+	}
+
+	if record.DNSWL.Trust.String() != "high" || record.DNSWL.Category.String() != "financial" {
+		t.Errorf("DNSWL reads %s %s", record.DNSWL.Trust, record.DNSWL.Category)
+	}
+
+	// Only 127.8.0.x answers aren't a blacklist hit
+	if record.Results[0].Found == false {
+		t.Error("127.8.C.T answers with a category aren't a blacklist hit")
+	}
+
+	record, err = (Api{}).ParseDNS([]net.IP{net.ParseIP("127.8.0.1"), net.ParseIP("127.8.0.2")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Results[0].Found || record.DNSWL == nil || record.DNSWL.Trust != TrustMedium || record.DNSWL.Category != 0 {
+		t.Errorf("127.8.0.x answers: found %t, DNSWL %+v", record.Results[0].Found, record.DNSWL)
+	}
+}
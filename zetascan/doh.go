@@ -0,0 +1,76 @@
+package zetascan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// dohContentType is the RFC 8484 wire format media type
+const dohContentType = "application/dns-message"
+
+// queryDoH sends the DNS query as an HTTPS POST to DohURL, returning the answers like queryDNS
+func (myapi Api) queryDoH(ctx context.Context, query string) (json []net.IP, txt []string, err error) {
+
+	// RFC 8484 recommends an ID of 0 so responses are cache friendly
+	msg := myapi.dnsMsg(query)
+	msg.Id = 0
+
+	packed, err := msg.Pack()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := myapi.newDoHRequest(ctx, packed)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := myapi.do(req)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, errors.New("DoH request failed with HTTP status " + strconv.Itoa(res.StatusCode) + ": " + myapi.DohURL)
+	}
+
+	body, err := myapi.readBody(res.Body)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in := new(dns.Msg)
+
+	if err := in.Unpack(body); err != nil {
+		return nil, nil, err
+	}
+
+	return dnsAnswers(in)
+}
+
+// newDoHRequest builds the POST carrying a packed DNS message to DohURL
+func (myapi Api) newDoHRequest(ctx context.Context, packed []byte) (*http.Request, error) {
+
+	req, err := myapi.newRequest(ctx, "POST", myapi.DohURL, bytes.NewReader(packed))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	return req, nil
+}
@@ -0,0 +1,94 @@
+package zetascan
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// dohHandler answers RFC 8484 POSTs with answers (A or TXT records in zone file format, the owner
+// name is the question)
+func dohHandler(t *testing.T, answers ...string) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		body, _ := io.ReadAll(r.Body)
+
+		query := new(dns.Msg)
+
+		if r.Header.Get("Content-Type") != dohContentType || query.Unpack(body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		reply := new(dns.Msg)
+		reply.SetReply(query)
+
+		for _, answer := range answers {
+
+			rr, err := dns.NewRR(query.Question[0].Name + " 60 IN " + answer)
+
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			reply.Answer = append(reply.Answer, rr)
+		}
+
+		packed, _ := reply.Pack()
+
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}
+}
+
+func TestQueryDoH(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(dohHandler(t, "A 127.0.1.2", "A 127.1.0.4")))
+	myapi.ApiMethod = "dns"
+	myapi.DnsMethod = "doh"
+
+	m, err := myapi.Query("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Results[0].Found == false || m.Status != StatusSuccess {
+		t.Errorf("unexpected record %+v", m)
+	}
+
+	want := []net.IP{net.ParseIP("127.0.1.2"), net.ParseIP("127.1.0.4")}
+
+	if len(m.ReturnCodes) != len(want) {
+		t.Fatalf("ReturnCodes = %v, want %v", m.ReturnCodes, want)
+	}
+
+	for i := range want {
+		if m.ReturnCodes[i].Equal(want[i]) == false {
+			t.Errorf("ReturnCodes = %v, want %v", m.ReturnCodes, want)
+		}
+	}
+}
+
+func TestQueryDoHNotListed(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(dohHandler(t)))
+	myapi.ApiMethod = "dns"
+	myapi.DnsMethod = "doh"
+
+	m, err := myapi.Query("okdomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Results[0].Found || m.Status != StatusNotFound {
+		t.Errorf("unexpected record %+v", m)
+	}
+}
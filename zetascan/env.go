@@ -0,0 +1,74 @@
+package zetascan
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by NewFromEnv
+const (
+	// EnvAPIKey is the default environment variable holding the API key
+	EnvAPIKey = "ZETASCAN_API_KEY"
+	// EnvMethod holds the query method (text, http, json, jsonx, xml or dns)
+	EnvMethod = "ZETASCAN_METHOD"
+	// EnvEndpoint holds the endpoint host, e.g. restlb.zetascan.com
+	EnvEndpoint = "ZETASCAN_ENDPOINT"
+	// EnvSSL holds whether to use https, as accepted by strconv.ParseBool
+	EnvSSL = "ZETASCAN_SSL"
+)
+
+// NewFromEnv returns an Api configured from the EnvAPIKey, EnvMethod, EnvEndpoint and EnvSSL
+// environment variables, unset ones keeping the Init defaults. Invalid values are an error.
+func NewFromEnv() (Api, error) {
+
+	myapi, err := Api{}.Init(os.Getenv(EnvAPIKey), false)
+
+	if err != nil {
+		return myapi, err
+	}
+
+	if method := os.Getenv(EnvMethod); method != "" {
+		if myapi, err = myapi.WithMethod(method); err != nil {
+			return myapi, fmt.Errorf("%s: %w", EnvMethod, err)
+		}
+	}
+
+	if endpoint := os.Getenv(EnvEndpoint); endpoint != "" {
+		if myapi, err = myapi.WithEndpoint(endpoint); err != nil {
+			return myapi, fmt.Errorf("%s: %w", EnvEndpoint, err)
+		}
+	}
+
+	if value := os.Getenv(EnvSSL); value != "" {
+
+		ssl, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return myapi, fmt.Errorf("%s: invalid value %q", EnvSSL, value)
+		}
+
+		if myapi, err = myapi.WithSSL(ssl); err != nil {
+			return myapi, fmt.Errorf("%s: %w", EnvSSL, err)
+		}
+
+	}
+
+	return myapi, nil
+}
+
+// WithKeyFromEnv returns a copy of the Api using the API key from the varName environment variable
+// (EnvAPIKey if empty), validated like a key passed to Init. A key already set explicitly (via
+// Init) takes precedence and the environment is then ignored.
+func (myapi Api) WithKeyFromEnv(varName string) (Api, error) {
+
+	if varName == "" {
+		varName = EnvAPIKey
+	}
+
+	if myapi.apiKey == "" {
+		myapi.apiKey = os.Getenv(varName)
+	}
+
+	return myapi, myapi.validate()
+}
@@ -0,0 +1,114 @@
+package zetascan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithKeyFromEnv(t *testing.T) {
+
+	t.Setenv("TEST_ZETASCAN_KEY", "ENVKEY")
+
+	myapi, err := Api{}.Init("", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if myapi, err = myapi.WithKeyFromEnv("TEST_ZETASCAN_KEY"); err != nil {
+		t.Fatal(err)
+	}
+
+	if u := myapi.getUrl("baddomain.org"); strings.HasSuffix(u, "?key=ENVKEY") == false {
+		t.Errorf("getUrl = %q, want the key from the environment", u)
+	}
+
+	// An explicit key wins
+	explicit, _ := Api{}.Init("EXPLICIT", false)
+
+	if explicit, _ = explicit.WithKeyFromEnv("TEST_ZETASCAN_KEY"); strings.HasSuffix(explicit.getUrl("baddomain.org"), "?key=EXPLICIT") == false {
+		t.Errorf("getUrl = %q, want the explicit key", explicit.getUrl("baddomain.org"))
+	}
+}
+
+func TestWithKeyFromEnvDefault(t *testing.T) {
+
+	t.Setenv(EnvAPIKey, "DEFAULTKEY")
+
+	myapi, _ := Api{}.Init("", false)
+
+	myapi, err := myapi.WithKeyFromEnv("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if myapi.GetConf() != "DEFAULTKEY" {
+		t.Errorf("key = %q, want the %s value", myapi.GetConf(), EnvAPIKey)
+	}
+
+	// The https requirement applies as to an explicit key
+	plain, _ := Api{}.Init("", false)
+	plain.apiProtocol = "http"
+
+	if _, err := plain.WithKeyFromEnv(""); err == nil {
+		t.Error("WithKeyFromEnv over http succeeded")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+
+	t.Setenv(EnvAPIKey, "ENVKEY")
+	t.Setenv(EnvMethod, "json")
+	t.Setenv(EnvEndpoint, "restlb.zetascan.com")
+	t.Setenv(EnvSSL, "true")
+
+	myapi, err := NewFromEnv()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u, want := myapi.getUrl("baddomain.org"), "https://restlb.zetascan.com/v2/check/json/baddomain.org?key=ENVKEY"; u != want {
+		t.Errorf("getUrl = %q, want %q", u, want)
+	}
+
+	tests := []struct {
+		name, value string
+	}{
+		{EnvMethod, "carrier-pigeon"},
+		{EnvSSL, "maybe"},
+		// The key isn't sent in clear text
+		{EnvSSL, "false"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+
+			t.Setenv(test.name, test.value)
+
+			if _, err := NewFromEnv(); err == nil || strings.HasPrefix(err.Error(), test.name) == false {
+				t.Errorf("err = %v, want an error naming %s", err, test.name)
+			}
+		})
+	}
+}
+
+func TestNewFromEnvDefaults(t *testing.T) {
+
+	for _, name := range []string{EnvAPIKey, EnvMethod, EnvEndpoint, EnvSSL} {
+		t.Setenv(name, "")
+	}
+
+	myapi, err := NewFromEnv()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults, _ := Api{}.Init("", false)
+
+	if myapi.getUrl("baddomain.org") != defaults.getUrl("baddomain.org") {
+		t.Errorf("getUrl = %q, want the Init default %q", myapi.getUrl("baddomain.org"), defaults.getUrl("baddomain.org"))
+	}
+}
@@ -0,0 +1,120 @@
+package zetascan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Helpers for the extended block, only returned by the jsonx method
+
+// ASN returns the autonomous system number of a listed item, false if absent or not numeric
+func (myapi Api) ASN(response *JsonRecord) (int, bool) {
+
+	if response == nil || len(response.Results) == 0 {
+		return 0, false
+	}
+
+	// Tolerate an "AS15169" style value
+	asn := strings.TrimSpace(response.Results[0].Extended.ASNum)
+	asn = strings.TrimPrefix(strings.ToUpper(asn), "AS")
+
+	number, err := strconv.Atoi(asn)
+
+	if err != nil || number < 0 {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// Country returns the upper cased country code of a listed item, empty if absent
+func (myapi Api) Country(response *JsonRecord) string {
+
+	if response == nil || len(response.Results) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(strings.TrimSpace(response.Results[0].Extended.Country))
+}
+
+// Reason returns why a jsonx result is listed (class, rule, type, source, ports), or ErrNoReason
+// when the record carries none. A dns TXT result carries the class, rule and type of its answers,
+// the full TXT strings are in Wldata.
+func (myapi Api) Reason(response *JsonRecord) (JsonReason, error) {
+
+	if response == nil || len(response.Results) == 0 {
+		return JsonReason{}, ErrNoReason
+	}
+
+	reason := response.Results[0].Extended.Reason
+
+	if reason == (JsonReason{}) {
+		return reason, ErrNoReason
+	}
+
+	return reason, nil
+}
+
+// ListedAt returns when a jsonx result was listed, parsed from the Unix timestamp in Extended.Time
+// (RFC 3339 is accepted too). An absent or malformed time is an error.
+func (myapi Api) ListedAt(response *JsonRecord) (time.Time, error) {
+
+	if response == nil || len(response.Results) == 0 || strings.TrimSpace(response.Results[0].Extended.Time) == "" {
+		return time.Time{}, errors.New("no listing time, only returned by the jsonx method")
+	}
+
+	value := strings.TrimSpace(response.Results[0].Extended.Time)
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	listed, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid listing time %q", value)
+	}
+
+	return listed, nil
+}
+
+// WithReverseDNS returns a copy of the Api resolving the PTR record of each queried IP via resolver
+// (net.DefaultResolver if nil), attaching the hostname as Extended.Domain when the response has
+// none. A failed PTR lookup leaves the result as is. The receiver is not modified.
+func (myapi Api) WithReverseDNS(resolver *net.Resolver) Api {
+
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	myapi.resolver = resolver
+
+	return myapi
+}
+
+// reverseDNS attaches the PTR hostname of an IP query to its results, see WithReverseDNS
+func (myapi Api) reverseDNS(ctx context.Context, query string, response *JsonRecord) {
+
+	if myapi.resolver == nil || net.ParseIP(query) == nil {
+		return
+	}
+
+	names, err := myapi.resolver.LookupAddr(ctx, query)
+
+	if err != nil || len(names) == 0 {
+		return
+	}
+
+	hostname := strings.TrimSuffix(names[0], ".")
+
+	for i := range response.Results {
+		if response.Results[i].Extended.Domain == "" {
+			response.Results[i].Extended.Domain = hostname
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package zetascan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestASN(t *testing.T) {
+
+	tests := []struct {
+		asnum string
+		asn   int
+		ok    bool
+	}{
+		{"15169", 15169, true},
+		{"AS15169", 15169, true},
+		{"", 0, false},
+		{"unknown", 0, false},
+	}
+
+	for _, test := range tests {
+
+		record := newRecord()
+		record.Results[0].Extended.ASNum = test.asnum
+
+		if asn, ok := (Api{}).ASN(&record); asn != test.asn || ok != test.ok {
+			t.Errorf("ASN(%q) = %d, %t, want %d, %t", test.asnum, asn, ok, test.asn, test.ok)
+		}
+	}
+}
+
+func TestCountry(t *testing.T) {
+
+	record := newRecord()
+	record.Results[0].Extended.Country = " us "
+
+	if country := (Api{}).Country(&record); country != "US" {
+		t.Errorf("Country = %q, want US", country)
+	}
+
+	if country := (Api{}).Country(&JsonRecord{}); country != "" {
+		t.Errorf("Country of an empty record = %q", country)
+	}
+}
+
+func TestReason(t *testing.T) {
+
+	data, err := parseJSON([]byte(jsonxBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, err := (Api{}).Reason(&data)
+
+	if err != nil || reason != data.Results[0].Extended.Reason || reason.Destination != "192.0.2.25" {
+		t.Errorf("Reason = %+v, %v", reason, err)
+	}
+
+	// A json result carries no extended block
+	if _, err := (Api{}).Reason(testRecord(true, false, 1, "dbl")); errors.Is(err, ErrNoReason) == false {
+		t.Errorf("Reason without an extended block: err = %v, want ErrNoReason", err)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+
+	reason, err := Api{ApiMethod: "jsonx"}.getInfo(testResponse(200, jsonxBody))
+
+	if err != nil || reason.Class != "botnet" || reason.Rule != "XBL-CBL" || reason.Port != "25" || reason.SourcePort != "41234" {
+		t.Errorf("getInfo = %+v, %v", reason, err)
+	}
+
+	if _, err := (Api{ApiMethod: "json"}).getInfo(testResponse(200, jsonxBody)); errors.Is(err, ErrNoReason) == false {
+		t.Errorf("getInfo with the json method: err = %v, want ErrNoReason", err)
+	}
+
+	body := `{"results":[{"item":"baddomain.org","found":true,"score":1}],"status":"success"}`
+
+	if _, err := (Api{ApiMethod: "jsonx"}).getInfo(testResponse(200, body)); errors.Is(err, ErrNoReason) == false {
+		t.Errorf("getInfo without a reason: err = %v, want ErrNoReason", err)
+	}
+}
+
+func TestReverseDNS(t *testing.T) {
+
+	addr := newDNSServer(t, answerHandler(t, "PTR mail.example.com."))
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", addr)
+		},
+	}
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("127.9.9.1")))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithReverseDNS(resolver)
+
+	m, err := myapi.Query("127.9.9.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if domain := m.Results[0].Extended.Domain; domain != "mail.example.com" {
+		t.Errorf("Extended.Domain = %q, want mail.example.com", domain)
+	}
+
+	// Domain queries have no PTR record to look up
+	if m, err = myapi.Query("baddomain.org"); err != nil || m.Results[0].Extended.Domain != "" {
+		t.Errorf("domain query = %+v, %v", m, err)
+	}
+}
+
+func TestListedAt(t *testing.T) {
+
+	data, err := parseJSON([]byte(jsonxBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := (Api{}).ListedAt(&data)
+
+	if err != nil || listed.Equal(time.Date(2017, 7, 25, 8, 21, 40, 0, time.UTC)) == false || listed.Unix() != 1500970900 {
+		t.Errorf("ListedAt = %v, %v, want 2017-07-25 08:21:40 UTC", listed, err)
+	}
+
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"2017-07-25T08:21:40Z", true},
+		{"", false},
+		{"yesterday", false},
+	}
+
+	for _, test := range tests {
+
+		record := newRecord()
+		record.Results[0].Extended.Time = test.value
+
+		if _, err := (Api{}).ListedAt(&record); (err == nil) != test.ok {
+			t.Errorf("ListedAt(%q): err = %v", test.value, err)
+		}
+	}
+}
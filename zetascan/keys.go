@@ -0,0 +1,106 @@
+package zetascan
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// keyBenchTime is how long a key rejected with 403/429 is skipped
+const keyBenchTime = time.Minute
+
+// keyRing rotates round-robin across several API keys, shared by copies of an Api
+type keyRing struct {
+	sync.Mutex
+	keys    []string
+	next    int
+	usage   map[string]int64
+	benched map[string]time.Time
+}
+
+// WithKeys returns a copy of the Api rotating round-robin across keys, one per query, to raise
+// the aggregate quota. A key rejected with 403 or 429 is benched for a minute and the query is sent
+// again right away with the next key, outside the WithRetry budget; it fails once every key is
+// benched. The keys are validated like a key passed to Init.
+func (myapi Api) WithKeys(keys []string) (Api, error) {
+
+	if len(keys) == 0 {
+		return myapi, errors.New("at least one API key must be specified")
+	}
+
+	myapi.keys = &keyRing{
+		keys:    append([]string(nil), keys...),
+		usage:   make(map[string]int64),
+		benched: make(map[string]time.Time),
+	}
+
+	// The first key stands in for validation and GetConf
+	myapi.apiKey = keys[0]
+
+	return myapi, myapi.validate()
+}
+
+// KeyUsage returns the number of queries sent with each key configured via WithKeys, by key masked
+// as in Config (keys masking alike add up)
+func (myapi Api) KeyUsage() map[string]int64 {
+
+	usage := make(map[string]int64)
+
+	if myapi.keys == nil {
+		return usage
+	}
+
+	myapi.keys.Lock()
+	defer myapi.keys.Unlock()
+
+	for key, count := range myapi.keys.usage {
+		usage[maskKey(key)] += count
+	}
+
+	return usage
+}
+
+// take returns the next key which isn't benched, or simply the next key when all are
+func (ring *keyRing) take() string {
+
+	ring.Lock()
+	defer ring.Unlock()
+
+	now := time.Now()
+	key := ring.keys[ring.next%len(ring.keys)]
+
+	for i := 0; i < len(ring.keys); i++ {
+
+		candidate := ring.keys[(ring.next+i)%len(ring.keys)]
+
+		if now.After(ring.benched[candidate]) {
+			key = candidate
+			ring.next += i
+			break
+		}
+
+	}
+
+	ring.next++
+	ring.usage[key]++
+
+	return key
+}
+
+// bench skips key for keyBenchTime, returning if another key isn't benched
+func (ring *keyRing) bench(key string) bool {
+
+	ring.Lock()
+	defer ring.Unlock()
+
+	now := time.Now()
+	ring.benched[key] = now.Add(keyBenchTime)
+
+	for _, other := range ring.keys {
+		if now.After(ring.benched[other]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package zetascan
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorsRedactKey(t *testing.T) {
+
+	for _, status := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusTooManyRequests} {
+
+		myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})))
+
+		// Rotating keys too, the live key of the attempt must not leak either
+		rotating, err := myapi.WithKeys([]string{testKey, "OTHERKEY"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, api := range []Api{myapi, rotating} {
+
+			_, err := api.Query("baddomain.org")
+
+			if err == nil {
+				t.Fatalf("HTTP %d: no error", status)
+			}
+
+			if strings.Contains(err.Error(), testKey) || strings.Contains(err.Error(), "OTHERKEY") || strings.Contains(err.Error(), "key=REDACTED") == false {
+				t.Errorf("HTTP %d: error %q doesn't redact the key", status, err)
+			}
+		}
+	}
+}
+
+func TestKeyRotationBenching(t *testing.T) {
+
+	var keys []string
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		key := r.URL.Query().Get("key")
+		keys = append(keys, key)
+
+		if strings.HasPrefix(key, "BAD") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		listedHandler()(w, r)
+	})))
+	myapi.ApiMethod = "json"
+
+	myapi, err := myapi.WithKeys([]string{"BADKEY-1111", "GOODKEY-2222"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rejected key is benched and the query fails over to the next one without a retry budget
+	for i := 0; i < 3; i++ {
+		if _, err := myapi.Query("okdomain.org"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if strings.Join(keys, " ") != "BADKEY-1111 GOODKEY-2222 GOODKEY-2222 GOODKEY-2222" {
+		t.Errorf("keys sent %v", keys)
+	}
+
+	if usage := myapi.KeyUsage(); len(usage) != 2 || usage["*******1111"] != 1 || usage["********2222"] != 3 {
+		t.Errorf("KeyUsage = %v, want counts by masked key", usage)
+	}
+
+	// Once every key is benched the error is returned
+	keys = nil
+	myapi, _ = myapi.WithKeys([]string{"BADKEY-1111", "BADKEY-3333"})
+
+	if _, err := myapi.Query("okdomain.org"); errors.Is(err, ErrRateLimited) == false {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+
+	if strings.Join(keys, " ") != "BADKEY-1111 BADKEY-3333" {
+		t.Errorf("keys sent %v, want each key once", keys)
+	}
+}
@@ -0,0 +1,105 @@
+package zetascan
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WithKey returns a copy of the Api using apiKey, replacing any keys rotated via WithKeys.
+// The copy is validated like Init, the receiver is not modified.
+func (myapi Api) WithKey(apiKey string) (Api, error) {
+
+	myapi.apiKey = apiKey
+	myapi.keys = nil
+
+	return myapi, myapi.validate()
+}
+
+// WithMethod returns a copy of the Api querying via method (text, http, json, jsonx, xml or dns).
+// The receiver is not modified.
+func (myapi Api) WithMethod(method string) (Api, error) {
+
+	method = strings.ToLower(method)
+
+	if method != "xml" && containsString(Methods, method) == false {
+		return myapi, fmt.Errorf("%w: %q", ErrUnsupportedMethod, method)
+	}
+
+	myapi.ApiMethod = method
+
+	return myapi, myapi.validate()
+}
+
+// WithEndpoint returns a copy of the Api querying endpoint, e.g. EndpointRestLB.
+// The receiver is not modified.
+func (myapi Api) WithEndpoint(endpoint string) (Api, error) {
+
+	if endpoint == "" {
+		return myapi, errors.New("endpoint must be specified")
+	}
+
+	myapi.apiURL = endpoint
+
+	return myapi, myapi.validate()
+}
+
+// WithSSL returns a copy of the Api using https (or plain http when ssl is false), failing like
+// Init if that would send the API key in clear text. The receiver is not modified.
+func (myapi Api) WithSSL(ssl bool) (Api, error) {
+
+	myapi.apiProtocol = myapi.ToggleSSL(ssl)
+
+	return myapi, myapi.validate()
+}
+
+// WithDnsType returns a copy of the Api looking up dnsType records (A or TXT). TXT answers fill
+// Wldata and Extended.Reason, an item is only Found from A answers. The receiver is not modified.
+func (myapi Api) WithDnsType(dnsType string) (Api, error) {
+
+	dnsType = strings.ToUpper(dnsType)
+
+	if dnsType != "A" && dnsType != "TXT" {
+		return myapi, fmt.Errorf("unsupported DNS type %q, use A or TXT", dnsType)
+	}
+
+	myapi.DnsType = dnsType
+
+	return myapi, myapi.validate()
+}
+
+// WithSubnetLookup returns a copy of the Api sending subnet=1 with IP queries, or subnet=0 when
+// subnet is false to force an exact-IP lookup: the listings of the containing subnet are then
+// ignored and FromSubnet is always false. Domain queries are unaffected. The receiver is not modified.
+func (myapi Api) WithSubnetLookup(subnet bool) Api {
+
+	if subnet {
+		myapi.subnet = "1"
+	} else {
+		myapi.subnet = "0"
+	}
+
+	return myapi
+}
+
+// WithFallback returns a copy of the Api falling back to the dns method when a web query can't
+// reach the endpoint (a connection error after any retries, not an error response), returning
+// the DNS result instead. The dns result has no scores or sources. The receiver is not modified.
+func (myapi Api) WithFallback(enabled bool) Api {
+
+	myapi.fallbackDNS = enabled
+
+	return myapi
+}
+
+// containsString reports if list holds value
+func containsString(list []string, value string) bool {
+
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package zetascan
+
+import (
+	"context"
+	"net/http"
+)
+
+// Plan describes the request a query would send, see PlanQuery
+type Plan struct {
+	// Method is the query method (http, text, json, jsonx, dns)
+	Method string
+	// Target is the full URL for web methods (the key redacted), or the DNS question name for dns
+	Target string
+	// Server is the nameserver address or DoH URL for dns, empty for web methods
+	Server string
+	// HTTPMethod and Headers (the auth header redacted) of the outbound HTTP request, empty for a
+	// plain nameserver lookup
+	HTTPMethod string
+	Headers    http.Header
+}
+
+// PlanQuery returns the request Query would send for query, without any network I/O. The API key is
+// redacted so the plan can be logged. An empty or oversized query fails as with Query.
+func (myapi Api) PlanQuery(query string) (plan Plan, err error) {
+
+	if query, err = myapi.checkQuery(query); err != nil {
+		return plan, err
+	}
+
+	plan.Method = myapi.ApiMethod
+
+	if myapi.ApiMethod == "dns" {
+
+		plan.Target = myapi.dnsMsg(query).Question[0].Name
+		plan.Server = myapi.dnsServer()
+
+		if myapi.DnsMethod != "doh" {
+			return plan, nil
+		}
+
+		plan.Server = myapi.DohURL
+
+		req, err := myapi.newDoHRequest(context.Background(), nil)
+
+		if err != nil {
+			return plan, err
+		}
+
+		plan.HTTPMethod, plan.Headers = req.Method, req.Header
+
+		return plan, nil
+	}
+
+	plan.Target = myapi.redactedUrl(query)
+
+	req, err := myapi.newQueryRequest(context.Background(), query)
+
+	if err != nil {
+		return plan, err
+	}
+
+	plan.HTTPMethod, plan.Headers = req.Method, myapi.redactHeader(req.Header)
+
+	return plan, nil
+}
@@ -0,0 +1,62 @@
+package zetascan
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlanQuery(t *testing.T) {
+
+	myapi, err := Api{}.Init(testKey, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	myapi.ApiMethod = "json"
+
+	plan, err := myapi.PlanQuery("baddomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Target != "https://api.zetascan.com/v2/check/json/baddomain.org?key=REDACTED" {
+		t.Errorf("json target = %q", plan.Target)
+	}
+
+	if plan.HTTPMethod != "GET" || plan.Headers.Get("Accept") != "application/json" || plan.Server != "" {
+		t.Errorf("unexpected json plan %+v", plan)
+	}
+
+	myapi.ApiMethod = "dns"
+
+	if plan, err = myapi.PlanQuery("baddomain.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Target != "baddomain.org." || plan.Server != "api.zetascan.com:53" || plan.HTTPMethod != "" {
+		t.Errorf("unexpected dns plan %+v", plan)
+	}
+}
+
+func TestPlanQueryRedactsKey(t *testing.T) {
+
+	myapi, _ := Api{}.Init(testKey, false)
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithHeaderAuth("")
+
+	plan, err := myapi.PlanQuery("  baddomain.org\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Target != "https://api.zetascan.com/v2/check/json/baddomain.org?" || plan.Headers.Get("X-API-Key") != "REDACTED" {
+		t.Errorf("plan %+v doesn't match the trimmed query with the key redacted", plan)
+	}
+
+	if _, err := myapi.PlanQuery("   "); errors.Is(err, ErrEmptyQuery) == false {
+		t.Errorf("err = %v, want ErrEmptyQuery", err)
+	}
+}
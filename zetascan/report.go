@@ -0,0 +1,40 @@
+package zetascan
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// csvHeader names the WriteCSV columns
+var csvHeader = []string{"item", "match", "expected", "passed", "time_elapsed_ms"}
+
+// WriteCSV writes Verify results to w as CSV, one row per test after a header row
+func WriteCSV(w io.Writer, results []Results) error {
+
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+
+		record := []string{
+			result.IP,
+			strconv.FormatBool(result.Match),
+			strconv.FormatBool(result.Expected),
+			strconv.FormatBool(result.Passed()),
+			strconv.FormatInt(result.TimeElapsed, 10),
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
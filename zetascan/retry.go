@@ -0,0 +1,196 @@
+package zetascan
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Retry backoff defaults, see WithRetry
+const (
+	DefaultRetryBase = 100 * time.Millisecond
+	DefaultRetryMax  = 5 * time.Second
+)
+
+// Jitter is how retry delays are randomized, see WithRetryJitter
+type Jitter int
+
+const (
+	// JitterNone waits the exponential delay exactly
+	JitterNone Jitter = iota
+	// JitterFull waits between zero and the exponential delay
+	JitterFull
+	// JitterEqual waits between half the exponential delay and the full delay
+	JitterEqual
+)
+
+// retryPolicy is how often and how long to wait before retrying a failed web query
+type retryPolicy struct {
+	retries int
+	base    time.Duration
+	max     time.Duration
+	jitter  Jitter
+	rand    *lockedRand
+
+	// Decides if an attempt is retried, DefaultRetryable if nil
+	predicate func(*http.Response, error) bool
+
+	// Waits out a delay unless ctx is done first, a timer if nil (replaced by tests)
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+// lockedRand is a random source safe for the concurrent queries of copies of an Api
+type lockedRand struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+// int63n returns a random number in [0, n)
+func (r *lockedRand) int63n(n int64) int64 {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.rand.Int63n(n)
+}
+
+// WithRetry returns a copy of the Api retrying a failed web query up to retries times, on a
+// connection error, 429 or 5xx (never 403 or 404, see WithRetryPredicate). The delay doubles from base (DefaultRetryBase if
+// zero) up to max (DefaultRetryMax if zero). With jitter each delay is drawn at random between zero
+// and that bound (JitterFull, see WithRetryJitter), so clients failing together don't retry in lockstep.
+// The receiver is not modified.
+func (myapi Api) WithRetry(retries int, base, max time.Duration, jitter bool) Api {
+
+	if base <= 0 {
+		base = DefaultRetryBase
+	}
+
+	if max <= 0 {
+		max = DefaultRetryMax
+	}
+
+	myapi.retry = retryPolicy{retries: retries, base: base, max: max, predicate: myapi.retry.predicate, sleep: myapi.retry.sleep}
+
+	if jitter {
+		return myapi.WithRetryJitter(JitterFull, nil)
+	}
+
+	return myapi
+}
+
+// WithRetryJitter returns a copy of the Api randomizing the WithRetry delays per mode, drawing from
+// source (seeded per instance if nil, pass a fixed source for deterministic tests). Call it after
+// WithRetry, which resets the jitter. Copies of the returned Api share the source.
+// The receiver is not modified.
+func (myapi Api) WithRetryJitter(mode Jitter, source rand.Source) Api {
+
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+
+	myapi.retry.jitter = mode
+	myapi.retry.rand = &lockedRand{rand: rand.New(source)}
+
+	return myapi
+}
+
+// WithRetryPredicate returns a copy of the Api deciding with retryable whether a failed web query
+// is retried, given the response (nil on a connection error) or the error. It replaces
+// DefaultRetryable, which it can wrap, e.g. to also retry 404s during a deployment window. Retries
+// still need WithRetry, and stop when the query's context is done. The receiver is not modified.
+func (myapi Api) WithRetryPredicate(retryable func(*http.Response, error) bool) Api {
+
+	myapi.retry.predicate = retryable
+
+	return myapi
+}
+
+// DefaultRetryable is the default retry predicate: retry a connection error, 429 or 5xx, but not
+// 403, 404 or any other response
+func DefaultRetryable(res *http.Response, err error) bool {
+
+	if err != nil {
+		return true
+	}
+
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// backoff returns the WithRetry backoff, the defaults without it, for DNS retries
+func (myapi Api) backoff() retryPolicy {
+
+	policy := myapi.retry
+
+	if policy.base <= 0 {
+		policy.base = DefaultRetryBase
+	}
+
+	if policy.max <= 0 {
+		policy.max = DefaultRetryMax
+	}
+
+	return policy
+}
+
+// retryable reports if a web query attempt failed in a way worth retrying
+func (myapi Api) retryable(ctx context.Context, res *http.Response, err error) bool {
+
+	// The caller gave up, another attempt would fail the same way
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if myapi.retry.predicate != nil {
+		return myapi.retry.predicate(res, err)
+	}
+
+	return DefaultRetryable(res, err)
+}
+
+// delay returns the backoff before retry attempt+1
+func (policy retryPolicy) delay(attempt int) time.Duration {
+
+	// Double from base, stopping at max
+	delay := policy.base
+
+	for i := 0; i < attempt && delay < policy.max; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.max {
+		delay = policy.max
+	}
+
+	if delay <= 0 || policy.rand == nil {
+		return delay
+	}
+
+	switch policy.jitter {
+	case JitterFull:
+		delay = time.Duration(policy.rand.int63n(int64(delay) + 1))
+	case JitterEqual:
+		delay = delay/2 + time.Duration(policy.rand.int63n(int64(delay-delay/2)+1))
+	}
+
+	return delay
+}
+
+// wait sleeps for the backoff before retry attempt+1, returning early with ctx.Err()
+func (policy retryPolicy) wait(ctx context.Context, attempt int) error {
+
+	if policy.sleep != nil {
+		return policy.sleep(ctx, policy.delay(attempt))
+	}
+
+	timer := time.NewTimer(policy.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
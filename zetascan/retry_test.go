@@ -0,0 +1,97 @@
+package zetascan
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRetryJitter(t *testing.T) {
+
+	policy := Api{}.WithRetry(5, 100*time.Millisecond, time.Second, true).retry
+
+	for attempt, bound := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+
+		seen := make(map[time.Duration]bool)
+
+		for i := 0; i < 50; i++ {
+
+			delay := policy.delay(attempt)
+
+			if delay < 0 || delay > bound {
+				t.Fatalf("attempt %d: delay %v outside [0, %v]", attempt, delay, bound)
+			}
+
+			seen[delay] = true
+		}
+
+		if len(seen) < 2 {
+			t.Errorf("attempt %d: 50 jittered delays are all %v", attempt, policy.delay(attempt))
+		}
+	}
+
+	// Without jitter the delay is exact
+	policy = Api{}.WithRetry(5, 100*time.Millisecond, time.Second, false).retry
+
+	if delay := policy.delay(2); delay != 400*time.Millisecond {
+		t.Errorf("delay = %v, want 400ms", delay)
+	}
+}
+
+func TestRetryJitterModes(t *testing.T) {
+
+	myapi := Api{}.WithRetry(3, 100*time.Millisecond, time.Second, false)
+
+	tests := []struct {
+		mode     Jitter
+		min, max time.Duration
+	}{
+		{JitterNone, 400 * time.Millisecond, 400 * time.Millisecond},
+		{JitterFull, 0, 400 * time.Millisecond},
+		{JitterEqual, 200 * time.Millisecond, 400 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+
+		// The same seed draws the same delays
+		a := myapi.WithRetryJitter(test.mode, rand.NewSource(1)).retry
+		b := myapi.WithRetryJitter(test.mode, rand.NewSource(1)).retry
+
+		for i := 0; i < 20; i++ {
+
+			delay := a.delay(2)
+
+			if other := b.delay(2); delay != other {
+				t.Fatalf("mode %d: delays %v and %v from the same seed", test.mode, delay, other)
+			}
+
+			if delay < test.min || delay > test.max {
+				t.Fatalf("mode %d: delay %v outside [%v, %v]", test.mode, delay, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestDNSRetryBackoff(t *testing.T) {
+
+	var delays []time.Duration
+
+	myapi := newDNSApi(t, silentDNSServer(t)).WithRetry(0, 100*time.Millisecond, time.Second, false)
+	myapi.DnsRetries = 2
+
+	// Record the delays instead of waiting them out
+	myapi.retry.sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return ctx.Err()
+	}
+
+	// Each of the 3 exchanges times out after the client's 2s read timeout
+	if _, err := myapi.Query("baddomain.org"); err == nil {
+		t.Fatal("Query of a silent server succeeded")
+	}
+
+	if len(delays) != 2 || delays[0] != 100*time.Millisecond || delays[1] != 200*time.Millisecond {
+		t.Errorf("delays = %v, want [100ms 200ms]", delays)
+	}
+}
@@ -0,0 +1,181 @@
+package zetascan
+
+import (
+	"strings"
+)
+
+// Source is a list an item was found in, in its canonical form (see NormalizeSource)
+type Source string
+
+// Sources documented by zetascan
+const (
+	SourceSBL   Source = "sbl"
+	SourceXBL   Source = "xbl"
+	SourcePBL   Source = "pbl"
+	SourceDBL   Source = "dbl"
+	SourceRed   Source = "red"
+	SourceGrey  Source = "grey"
+	SourceGold  Source = "gold"
+	SourceBlack Source = "black"
+	SourceWhite Source = "white"
+)
+
+// Category groups sources by the kind of listing
+type Category string
+
+const (
+	CategorySpam      Category = "spam"
+	CategoryExploit   Category = "exploit"
+	CategoryPolicy    Category = "policy"
+	CategoryWhiteList Category = "whitelist"
+	CategoryUnknown   Category = "unknown"
+)
+
+// sourceNames maps the sources to a readable name
+var sourceNames = map[Source]string{
+	SourceSBL:   "Spamhaus SBL",
+	SourceXBL:   "Spamhaus XBL",
+	SourcePBL:   "Spamhaus PBL",
+	SourceDBL:   "Spamhaus DBL",
+	SourceRed:   "URIBL Red",
+	SourceGrey:  "URIBL Grey",
+	SourceGold:  "URIBL Gold",
+	SourceBlack: "URIBL Black",
+	SourceWhite: "Zetascan whitelist",
+}
+
+// sourceCategories maps the sources to their category
+var sourceCategories = map[Source]Category{
+	SourceSBL:   CategorySpam,
+	SourceXBL:   CategoryExploit,
+	SourcePBL:   CategoryPolicy,
+	SourceDBL:   CategorySpam,
+	SourceRed:   CategorySpam,
+	SourceGrey:  CategoryPolicy,
+	SourceGold:  CategorySpam,
+	SourceBlack: CategorySpam,
+	SourceWhite: CategoryWhiteList,
+}
+
+// SourceCategory classifies a source: Spamhaus SBL/DBL and the URIBL red/gold/black lists are spam,
+// XBL lists exploited hosts, PBL and the URIBL grey list are policy listings.
+func SourceCategory(source Source) Category {
+
+	if category, ok := sourceCategories[Source(NormalizeSource(string(source)))]; ok {
+		return category
+	}
+
+	return CategoryUnknown
+}
+
+// Sources returns the typed, canonical sources the item was found in
+func (myapi Api) Sources(response *JsonRecord) []Source {
+
+	if response == nil || len(response.Results) == 0 {
+		return nil
+	}
+
+	sources := make([]Source, len(response.Results[0].Sources))
+
+	for i, source := range response.Results[0].Sources {
+		sources[i] = Source(NormalizeSource(source))
+	}
+
+	return sources
+}
+
+// NormalizeSource returns the canonical form of a source code, so it compares equal across methods.
+// The http method returns upper case codes (DBL), text lower case (dbl) and json prefixes them with
+// the provider, "sh" for Spamhaus and "ub" for URIBL (shDBL): all three normalize to "dbl".
+func NormalizeSource(source string) string {
+
+	source = strings.ToLower(strings.TrimSpace(source))
+
+	for _, prefix := range []string{"sh", "ub"} {
+
+		code := strings.TrimPrefix(source, prefix)
+
+		if _, known := sourceNames[Source(code)]; known && code != source {
+			return code
+		}
+
+	}
+
+	return source
+}
+
+// NormalizeSources returns a copy of sources with every code in its canonical form
+func NormalizeSources(sources []string) []string {
+
+	normalized := make([]string, len(sources))
+
+	for i, source := range sources {
+		normalized[i] = NormalizeSource(source)
+	}
+
+	return normalized
+}
+
+// SourceNames returns a readable name for each source the item was found in, unknown codes are
+// returned as-is
+func (myapi Api) SourceNames(response *JsonRecord) []string {
+
+	if response == nil || len(response.Results) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(response.Results[0].Sources))
+
+	for _, source := range response.Results[0].Sources {
+
+		if name, ok := sourceNames[Source(NormalizeSource(source))]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, source)
+		}
+
+	}
+
+	return names
+}
+
+// FilterSources returns a copy of response keeping only the allowed sources (compared in their
+// canonical form), e.g. FilterSources(response, "dbl") for DBL hits only. Found is recomputed: an
+// item stays found only if an allowed source listed it, so results without sources (dns) read clean.
+func (myapi Api) FilterSources(response *JsonRecord, allowed ...string) *JsonRecord {
+
+	if response == nil {
+		return nil
+	}
+
+	keep := make(map[string]bool, len(allowed))
+
+	for _, source := range allowed {
+		keep[NormalizeSource(source)] = true
+	}
+
+	filtered := *response
+	filtered.Results = append(JsonResults(nil), response.Results...)
+
+	for i := range filtered.Results {
+
+		var sources []string
+
+		for _, source := range filtered.Results[i].Sources {
+			if keep[NormalizeSource(source)] {
+				sources = append(sources, source)
+			}
+		}
+
+		filtered.Results[i].Sources = sources
+		filtered.Results[i].Found = filtered.Results[i].Found && len(sources) > 0
+
+	}
+
+	// A synthesized status follows the recomputed listing
+	if len(filtered.Results) > 0 && (filtered.Status == StatusSuccess || filtered.Status == StatusNotFound) {
+		filtered.Status = syntheticStatus(&filtered)
+	}
+
+	return &filtered
+}
@@ -0,0 +1,74 @@
+package zetascan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceNames(t *testing.T) {
+
+	record := testRecord(true, false, 1, "sbl", "xbl", "dbl", "zzz")
+
+	want := []string{"Spamhaus SBL", "Spamhaus XBL", "Spamhaus DBL", "zzz"}
+
+	if names := (Api{}).SourceNames(record); reflect.DeepEqual(names, want) == false {
+		t.Errorf("SourceNames = %q, want %q", names, want)
+	}
+}
+
+func TestNormalizeSourcesAcrossMethods(t *testing.T) {
+
+	res := testResponse(200, "")
+	res.Header.Set("x-zetascan-items", "baddomain.org")
+	res.Header.Set("x-zetascan-score", "1")
+	res.Header.Set("x-zetascan-sources", "DBL;RED;GREY")
+
+	fromHTTP, err := Api{ApiMethod: "http"}.parseResult(res)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromText, err := Api{ApiMethod: "text"}.parseResult(testResponse(200, "baddomain.org:true,false,,1,0.6,dbl,red,grey"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, err := Api{ApiMethod: "json"}.parseResult(testResponse(200, `{"results":[{"item":"baddomain.org","found":true,"sources":["shDBL","ubRED","ubGREY"]}]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"dbl", "red", "grey"}
+
+	for method, data := range map[string]JsonRecord{"http": fromHTTP, "text": fromText, "json": fromJSON} {
+		if sources := NormalizeSources(data.Results[0].Sources); reflect.DeepEqual(sources, want) == false {
+			t.Errorf("%s sources normalize to %q, want %q", method, sources, want)
+		}
+	}
+}
+
+func TestFilterSources(t *testing.T) {
+
+	record := testRecord(true, false, 1, "xbl", "sbl")
+	record.Status = StatusSuccess
+
+	filtered := (Api{}).FilterSources(record, "dbl")
+
+	if filtered.Results[0].Found || len(filtered.Results[0].Sources) != 0 || filtered.Status != StatusNotFound {
+		t.Errorf("filtered = %+v, want not found", filtered)
+	}
+
+	if record.Results[0].Found == false || len(record.Results[0].Sources) != 2 {
+		t.Errorf("FilterSources modified the response %+v", record)
+	}
+
+	// A DBL hit survives
+	filtered = (Api{}).FilterSources(testRecord(true, false, 1, "xbl", "DBL"), "dbl")
+
+	if filtered.Results[0].Found == false || reflect.DeepEqual(filtered.Results[0].Sources, []string{"DBL"}) == false {
+		t.Errorf("filtered = %+v, want found by DBL", filtered)
+	}
+}
@@ -0,0 +1,88 @@
+package zetascan
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyStats summarizes the query durations of a Verify run
+type LatencyStats struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// Summarize computes the latency statistics across results from their TimeElapsed (ms)
+func Summarize(results []Results) (stats LatencyStats) {
+
+	if len(results) == 0 {
+		return stats
+	}
+
+	durations := make([]time.Duration, len(results))
+
+	var total time.Duration
+
+	for i, result := range results {
+		durations[i] = time.Duration(result.TimeElapsed) * time.Millisecond
+		total += durations[i]
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	stats.Count = len(durations)
+	stats.Min = durations[0]
+	stats.Max = durations[len(durations)-1]
+	stats.Mean = total / time.Duration(len(durations))
+	stats.P50 = percentile(durations, 50)
+	stats.P95 = percentile(durations, 95)
+	stats.P99 = percentile(durations, 99)
+
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p (0-100] of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// VerifyLatency runs Verify (its tests run concurrently, see Concurrency) and returns the latency
+// summary alongside the results, for synthetic monitoring of the live API
+func (myapi Api) VerifyLatency(status bool, verbose bool) (totalResults []Results, stats LatencyStats, err error) {
+
+	totalResults, err = myapi.Verify(status, verbose)
+
+	return totalResults, Summarize(totalResults), err
+}
+
+// LastDuration returns how long the most recently finished QueryContext (or Query) took, zero before
+// any query. Safe to read while querying: with concurrent queries it reflects whichever finished last.
+func (myapi Api) LastDuration() time.Duration {
+
+	if myapi.lastDuration == nil {
+		return 0
+	}
+
+	return time.Duration(atomic.LoadInt64(myapi.lastDuration))
+}
+
+// recordDuration stores the time since start as the LastDuration
+func (myapi Api) recordDuration(start time.Time) {
+
+	if myapi.lastDuration != nil {
+		atomic.StoreInt64(myapi.lastDuration, int64(time.Since(start)))
+	}
+}
@@ -0,0 +1,75 @@
+package zetascan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerifyLatency(t *testing.T) {
+
+	delays := map[string]time.Duration{"okdomain.org": 10 * time.Millisecond, "baddomain.org": 80 * time.Millisecond}
+
+	myapi := newTestApi(t, httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		delay := 40 * time.Millisecond
+
+		for item, d := range delays {
+			if r.URL.Path == "/v2/check/json/"+item {
+				delay = d
+			}
+		}
+
+		time.Sleep(delay)
+		listedHandler("baddomain.org", "127.9.9.1", "127.9.9.2", "127.9.9.3")(w, r)
+	})))
+	myapi.ApiMethod = "json"
+
+	results, stats, err := myapi.VerifyLatency(false, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Count != len(results) || stats.Count != 6 {
+		t.Fatalf("stats over %d results, want 6", stats.Count)
+	}
+
+	if stats.Min < 10*time.Millisecond || stats.Max < 80*time.Millisecond || stats.Max > 2*time.Second {
+		t.Errorf("min %v, max %v out of bounds", stats.Min, stats.Max)
+	}
+
+	if stats.Mean < stats.Min || stats.Mean > stats.Max || stats.P50 < 40*time.Millisecond || stats.P95 != stats.Max || stats.P99 != stats.Max {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+
+	var results []Results
+
+	for ms := int64(1); ms <= 100; ms++ {
+		results = append(results, Results{TimeElapsed: ms})
+	}
+
+	stats := Summarize(results)
+
+	want := LatencyStats{
+		Count: 100,
+		Min:   time.Millisecond,
+		Max:   100 * time.Millisecond,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}
+
+	if stats != want {
+		t.Errorf("Summarize = %+v, want %+v", stats, want)
+	}
+
+	if stats := Summarize(nil); stats != (LatencyStats{}) {
+		t.Errorf("Summarize(nil) = %+v", stats)
+	}
+}
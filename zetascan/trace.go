@@ -0,0 +1,99 @@
+package zetascan
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// SpanName is the name of the span started around each query, see WithTracer
+const SpanName = "zetascan.query"
+
+// Tracer starts spans around queries, e.g. an adapter over an OpenTelemetry tracer. This keeps
+// tracing optional without this package depending on a tracing library.
+type Tracer interface {
+	// Start starts a span named name with attrs, returning the context carrying it
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+	// Inject propagates the span in ctx into the headers of an outbound request
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	// SetStatusCode records the HTTP status code of the query
+	SetStatusCode(code int)
+	// End ends the span, recording err when the query failed
+	End(err error)
+}
+
+// spanKey is the context key holding the current Span
+type spanKey struct{}
+
+// WithTracer returns a copy of the Api starting a SpanName span around each QueryContext with the
+// method, endpoint and masked query as attributes. The span ends with the query error, and its
+// context is passed to tracer.Inject for every HTTP request. The receiver is not modified.
+func (myapi Api) WithTracer(tracer Tracer) Api {
+
+	myapi.tracer = tracer
+
+	return myapi
+}
+
+// startSpan starts the span of a query, a nil Span when tracing is off
+func (myapi Api) startSpan(ctx context.Context, query string) (context.Context, Span) {
+
+	if myapi.tracer == nil {
+		return ctx, nil
+	}
+
+	endpoint := myapi.apiURL
+
+	if myapi.ApiMethod == "dns" {
+		endpoint = myapi.dnsServer()
+
+		if myapi.DnsMethod == "doh" {
+			endpoint = myapi.DohURL
+		}
+	}
+
+	ctx, span := myapi.tracer.Start(ctx, SpanName, map[string]string{
+		"zetascan.method":   myapi.ApiMethod,
+		"zetascan.endpoint": endpoint,
+		"zetascan.query":    maskQuery(query),
+	})
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// endSpan ends span with the query error, if tracing
+func endSpan(span Span, err error) {
+
+	if span != nil {
+		span.End(err)
+	}
+}
+
+// recordStatus records the HTTP status code on the span in ctx, if tracing
+func recordStatus(ctx context.Context, code int) {
+
+	if span, ok := ctx.Value(spanKey{}).(Span); ok && span != nil {
+		span.SetStatusCode(code)
+	}
+}
+
+// maskQuery hides the host part of an IP (the last octet, or past the /48 for IPv6), domains are
+// returned as-is
+func maskQuery(query string) string {
+
+	ip := net.ParseIP(query)
+
+	if ip == nil {
+		return query
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
@@ -0,0 +1,88 @@
+package zetascan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// recordingTracer records the spans it starts and propagates a traceparent header
+type recordingTracer struct {
+	sync.Mutex
+	spans []*recordingSpan
+}
+
+// recordingSpan records what a query reported on its span
+type recordingSpan struct {
+	name   string
+	attrs  map[string]string
+	status int
+	ended  bool
+	err    error
+}
+
+func (tracer *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	span := &recordingSpan{name: name, attrs: attrs}
+	tracer.spans = append(tracer.spans, span)
+
+	return ctx, span
+}
+
+func (tracer *recordingTracer) Inject(ctx context.Context, header http.Header) {
+	header.Set("Traceparent", "00-trace-span-01")
+}
+
+func (span *recordingSpan) SetStatusCode(code int) { span.status = code }
+
+func (span *recordingSpan) End(err error) { span.ended, span.err = true, err }
+
+func TestTracer(t *testing.T) {
+
+	var headers http.Header
+
+	tracer := &recordingTracer{}
+
+	myapi := newTestApi(t, httptest.NewTLSServer(headerHandler(&headers, "127.9.9.1")))
+	myapi.ApiMethod = "json"
+	myapi = myapi.WithTracer(tracer)
+
+	if _, err := myapi.Query("127.9.9.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("%d spans started, want 1", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+
+	if span.name != SpanName || span.attrs["zetascan.method"] != "json" || span.attrs["zetascan.query"] != "127.9.9.0/24" {
+		t.Errorf("span %q with attributes %v", span.name, span.attrs)
+	}
+
+	if span.status != http.StatusOK || span.ended == false || span.err != nil {
+		t.Errorf("span status %d, ended %t, err %v", span.status, span.ended, span.err)
+	}
+
+	if got := headers.Get("Traceparent"); got != "00-trace-span-01" {
+		t.Errorf("Traceparent = %q, not injected", got)
+	}
+
+	// A failed query ends its span with the error
+	myapi.ApiMethod = "dns"
+	myapi.DnsEndpoint = newDNSServer(t, rcodeHandler(dns.RcodeServerFailure))
+
+	_, err := myapi.Query("127.9.9.1")
+
+	if err == nil || len(tracer.spans) != 2 || tracer.spans[1].ended == false || tracer.spans[1].err != err {
+		t.Errorf("err = %v, spans %+v, want the second span ended with it", err, tracer.spans)
+	}
+}
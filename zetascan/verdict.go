@@ -0,0 +1,228 @@
+package zetascan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInconsistentRecord is returned by CheckConsistency for contradictory listing fields
+var ErrInconsistentRecord = errors.New("inconsistent record")
+
+// Verdict is the single authoritative answer for a queried item
+type Verdict int
+
+const (
+	// VerdictClean the item is neither blacklisted nor whitelisted
+	VerdictClean Verdict = iota
+	// VerdictWhiteList the item is trusted via a whitelist
+	VerdictWhiteList
+	// VerdictBlackList the item is listed in one or more blacklists
+	VerdictBlackList
+)
+
+// String returns a readable name for the verdict
+func (v Verdict) String() string {
+
+	switch v {
+	case VerdictWhiteList:
+		return "whitelist"
+	case VerdictBlackList:
+		return "blacklist"
+	}
+
+	return "clean"
+}
+
+// Verdict combines the whitelist/blacklist predicates into one answer plus a readable reason.
+//
+// Precedence: by default a whitelist hit overrides a blacklist hit (matching IsBlackList),
+// set BlackListPrecedence to let a blacklist hit win instead. Subnet listings (see IsFromSubnet)
+// are flagged as lower confidence in the reason, or treated as clean with IgnoreSubnet.
+func (myapi Api) Verdict(response *JsonRecord) (verdict Verdict, reason string) {
+
+	if response == nil || len(response.Results) == 0 {
+		return VerdictClean, "no results returned"
+	}
+
+	result := response.Results[0]
+
+	// Build the reasons from the whitelist data and the matched sources
+	wlReason := "whitelisted"
+	if result.Wldata != "" {
+		wlReason += ": " + result.Wldata
+	}
+
+	blReason := "blacklisted"
+	if len(result.Sources) > 0 {
+		blReason += " by " + strings.Join(result.Sources, ", ")
+	}
+
+	// A listing of the containing subnet rather than the exact IP is lower confidence
+	if result.Found && result.FromSubnet {
+
+		if myapi.IgnoreSubnet {
+			result.Found = false
+		}
+
+		blReason += " (subnet listing, lower confidence)"
+	}
+
+	switch {
+	case result.Found && result.Wl:
+		if myapi.BlackListPrecedence {
+			return VerdictBlackList, blReason + " (overrides whitelist)"
+		}
+		return VerdictWhiteList, wlReason + " (overrides blacklist)"
+
+	case result.Wl:
+		return VerdictWhiteList, wlReason
+
+	case result.Found:
+		return VerdictBlackList, blReason
+	}
+
+	if response.Results[0].Found {
+		return VerdictClean, "subnet listing ignored"
+	}
+
+	return VerdictClean, "not listed"
+
+}
+
+// IsClean returns if the item is simply unknown: neither found on a blacklist nor whitelisted, false
+// when there are no results. A whitelisted item is never blacklisted (IsBlackList is false) but it is
+// not clean either, IsWhiteList reports it. For any record exactly one of IsClean, IsWhiteList and
+// IsBlackList holds, as with Verdict under the default precedence.
+func (myapi Api) IsClean(response *JsonRecord) bool {
+
+	if response == nil || len(response.Results) == 0 {
+		return false
+	}
+
+	return response.Results[0].Found == false && response.Results[0].Wl == false
+}
+
+// IsFromParentDomain returns if a listing of the queried domain is for a parent domain, e.g. a hit
+// on baddomain.org for www.baddomain.org. The API doesn't flag this like FromSubnet, so the returned
+// item is compared with query.
+func (myapi Api) IsFromParentDomain(response *JsonRecord, query string) bool {
+
+	if response == nil || len(response.Results) == 0 || response.Results[0].Found == false {
+		return false
+	}
+
+	item := strings.ToLower(strings.Trim(response.Results[0].Item, "."))
+	query = strings.ToLower(strings.Trim(strings.TrimSpace(query), "."))
+
+	if item == "" || item == query {
+		return false
+	}
+
+	return strings.HasSuffix(query, "."+item)
+}
+
+// IsFromSubnet returns if a listing is for the containing subnet rather than the exact IP (json/jsonx only)
+func (myapi Api) IsFromSubnet(response *JsonRecord) bool {
+
+	if response == nil || len(response.Results) == 0 {
+		return false
+	}
+
+	return response.Results[0].Found && response.Results[0].FromSubnet
+}
+
+// ShouldBlock returns true when the record is blacklisted and its (MTA/default) score meets or
+// exceeds the threshold. Whitelisted records are never blocked, regardless of BlackListPrecedence.
+func (myapi Api) ShouldBlock(response *JsonRecord, threshold float64) bool {
+
+	if response == nil || len(response.Results) == 0 || !myapi.IsBlackList(response) {
+		return false
+	}
+
+	return response.Results[0].Score >= threshold
+
+}
+
+// CombinedScore blends the MTA/default score and the webscore: weightScore*score + weightWeb*webscore.
+// The weights are normalized to sum to 1 (negative weights count as 0, all zero means a 50/50 split).
+func (myapi Api) CombinedScore(response *JsonRecord, weightScore, weightWeb float64) float64 {
+
+	if response == nil || len(response.Results) == 0 {
+		return 0
+	}
+
+	if weightScore < 0 {
+		weightScore = 0
+	}
+
+	if weightWeb < 0 {
+		weightWeb = 0
+	}
+
+	total := weightScore + weightWeb
+
+	if total == 0 {
+		weightScore, weightWeb, total = 1, 1, 2
+	}
+
+	return (weightScore*myapi.Score(response) + weightWeb*myapi.WebScore(response)) / total
+
+}
+
+// DefaultCombinedScore is CombinedScore with an equal 50/50 weighting
+func (myapi Api) DefaultCombinedScore(response *JsonRecord) float64 {
+	return myapi.CombinedScore(response, 0.5, 0.5)
+}
+
+// NormalizedScore maps the scores to a 0-100 risk value: the higher of score and webscore (nominally
+// 0 to 1, negative when whitelisted) times 100, rounded and clamped to 0-100. No results is 0.
+func (myapi Api) NormalizedScore(response *JsonRecord) int {
+
+	if response == nil || len(response.Results) == 0 {
+		return 0
+	}
+
+	risk := math.Round(100 * math.Max(response.Results[0].Score, response.Results[0].WebScore))
+
+	if math.IsNaN(risk) {
+		return 0
+	}
+
+	return int(math.Max(0, math.Min(100, risk)))
+}
+
+// CheckConsistency flags contradictions in a parsed record, e.g. from the http method's header
+// workarounds: a blacklist hit with a negative score, or an item both blacklisted and whitelisted.
+// The record is still usable, Verdict resolves the precedence, treat the error as a warning.
+func (myapi Api) CheckConsistency(response *JsonRecord) error {
+
+	if response == nil {
+		return nil
+	}
+
+	var problems []string
+
+	for _, result := range response.Results {
+
+		if result.Found && result.Score < 0 {
+			problems = append(problems, fmt.Sprintf("%s: found with negative score %v", result.Item, result.Score))
+		}
+
+		if result.Found && result.Wl {
+			problems = append(problems, fmt.Sprintf("%s: both blacklisted and whitelisted", result.Item))
+		}
+
+		if result.Wl && result.Found == false && result.Score > 0 {
+			problems = append(problems, fmt.Sprintf("%s: whitelisted with positive score %v", result.Item, result.Score))
+		}
+
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInconsistentRecord, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
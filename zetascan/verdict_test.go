@@ -0,0 +1,232 @@
+package zetascan
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRecord returns a record holding a single result with the listing fields set
+func testRecord(found, wl bool, score float64, sources ...string) *JsonRecord {
+
+	record := newRecord()
+	record.Results[0].Found = found
+	record.Results[0].Wl = wl
+	record.Results[0].Score = score
+	record.Results[0].Sources = sources
+
+	return &record
+}
+
+func TestVerdict(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		record     *JsonRecord
+		blackFirst bool
+		verdict    Verdict
+		reason     string
+	}{
+		{"clean", testRecord(false, false, 0), false, VerdictClean, "not listed"},
+		{"blacklist", testRecord(true, false, 1, "dbl", "red"), false, VerdictBlackList, "blacklisted by dbl, red"},
+		{"whitelist", testRecord(false, true, -0.1, "white"), false, VerdictWhiteList, "whitelisted"},
+		{"both, whitelist wins", testRecord(true, true, 1, "dbl"), false, VerdictWhiteList, "whitelisted (overrides blacklist)"},
+		{"both, blacklist wins", testRecord(true, true, 1, "dbl"), true, VerdictBlackList, "blacklisted by dbl (overrides whitelist)"},
+		{"no results", &JsonRecord{}, false, VerdictClean, "no results returned"},
+		{"nil", nil, false, VerdictClean, "no results returned"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			myapi := Api{BlackListPrecedence: test.blackFirst}
+
+			verdict, reason := myapi.Verdict(test.record)
+
+			if verdict != test.verdict || reason != test.reason {
+				t.Errorf("Verdict = %v, %q, want %v, %q", verdict, reason, test.verdict, test.reason)
+			}
+		})
+	}
+}
+
+func TestVerdictWhiteListData(t *testing.T) {
+
+	record := testRecord(false, true, -0.1)
+	record.Results[0].Wldata = "trusted sender"
+
+	if _, reason := (Api{}).Verdict(record); strings.Contains(reason, "trusted sender") == false {
+		t.Errorf("reason %q doesn't carry the wldata", reason)
+	}
+}
+
+func TestShouldBlock(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		record *JsonRecord
+		block  bool
+	}{
+		{"above threshold", testRecord(true, false, 0.9), true},
+		{"equal to threshold", testRecord(true, false, 0.5), true},
+		{"below threshold", testRecord(true, false, 0.4), false},
+		{"whitelisted high score", testRecord(true, true, 1), false},
+		{"clean", testRecord(false, false, 0.9), false},
+		{"nil", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if block := (Api{}).ShouldBlock(test.record, 0.5); block != test.block {
+				t.Errorf("ShouldBlock = %t, want %t", block, test.block)
+			}
+		})
+	}
+}
+
+func TestSubnetListing(t *testing.T) {
+
+	body := `{"results":[{"item":"127.9.9.1","found":true,"score":0.8,"fromSubnet":true,"sources":["shXBL"]}],"status":"success"}`
+
+	record, err := Api{ApiMethod: "json"}.parseResult(testResponse(200, body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (Api{}).IsFromSubnet(&record) == false {
+		t.Error("IsFromSubnet = false for a subnet listing")
+	}
+
+	if (Api{}).IsFromSubnet(testRecord(true, false, 1, "dbl")) {
+		t.Error("IsFromSubnet = true for an exact listing")
+	}
+
+	verdict, reason := (Api{}).Verdict(&record)
+
+	if verdict != VerdictBlackList || reason != "blacklisted by shXBL (subnet listing, lower confidence)" {
+		t.Errorf("Verdict = %v, %q", verdict, reason)
+	}
+
+	verdict, reason = Api{IgnoreSubnet: true}.Verdict(&record)
+
+	if verdict != VerdictClean || reason != "subnet listing ignored" {
+		t.Errorf("Verdict with IgnoreSubnet = %v, %q", verdict, reason)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+
+	myapi := newTestApi(t, httptest.NewTLSServer(listedHandler("baddomain.org")))
+	myapi.ApiMethod = "json"
+
+	json, err := myapi.Query("okdomain.org")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := Api{ApiMethod: "text"}.parseResult(testResponse(200, "okdomain.org:false,false,,0,0"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for method, record := range map[string]*JsonRecord{"json": &json, "text": &text} {
+
+		if (Api{}).IsClean(record) == false || (Api{}).IsBlackList(record) || (Api{}).IsWhiteList(record) {
+			t.Errorf("%s: not found record %+v isn't clean", method, record)
+		}
+
+		if record.Status != StatusNotFound {
+			t.Errorf("%s: Status = %q, want %q", method, record.Status, StatusNotFound)
+		}
+	}
+}
+
+func TestNormalizedScore(t *testing.T) {
+
+	webscored := testRecord(true, false, 0.2)
+	webscored.Results[0].WebScore = 0.6
+
+	tests := []struct {
+		name   string
+		record *JsonRecord
+		risk   int
+	}{
+		{"clean", testRecord(false, false, 0), 0},
+		{"high", testRecord(true, false, 0.95), 95},
+		{"webscore higher", webscored, 60},
+		{"above range", testRecord(true, false, 1.7), 100},
+		{"whitelisted", testRecord(false, true, -0.1), 0},
+		{"nil", nil, 0},
+	}
+
+	for _, test := range tests {
+		if risk := (Api{}).NormalizedScore(test.record); risk != test.risk {
+			t.Errorf("%s: NormalizedScore = %d, want %d", test.name, risk, test.risk)
+		}
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		record  *JsonRecord
+		problem string
+	}{
+		{"consistent blacklist", testRecord(true, false, 1, "dbl"), ""},
+		{"consistent whitelist", testRecord(false, true, -0.1, "white"), ""},
+		{"clean", testRecord(false, false, 0), ""},
+		{"nil", nil, ""},
+		{"found with negative score", testRecord(true, false, -0.1, "dbl"), "found with negative score -0.1"},
+		{"blacklisted and whitelisted", testRecord(true, true, 1, "dbl"), "both blacklisted and whitelisted"},
+		{"whitelisted with positive score", testRecord(false, true, 0.5, "white"), "whitelisted with positive score 0.5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			err := (Api{}).CheckConsistency(test.record)
+
+			if test.problem == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+
+			if errors.Is(err, ErrInconsistentRecord) == false || strings.Contains(err.Error(), test.problem) == false {
+				t.Errorf("err = %v, want ErrInconsistentRecord with %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestIsFromParentDomain(t *testing.T) {
+
+	listed := testRecord(true, false, 1, "dbl")
+	listed.Results[0].Item = "baddomain.org"
+
+	tests := []struct {
+		query  string
+		record *JsonRecord
+		parent bool
+	}{
+		{"www.baddomain.org", listed, true},
+		{"a.b.BadDomain.org.", listed, true},
+		{"baddomain.org", listed, false},
+		{"notbaddomain.org", listed, false},
+		{"www.baddomain.org", testRecord(false, false, 0), false},
+		{"www.baddomain.org", nil, false},
+	}
+
+	for _, test := range tests {
+		if parent := (Api{}).IsFromParentDomain(test.record, test.query); parent != test.parent {
+			t.Errorf("IsFromParentDomain(%q) = %t, want %t", test.query, parent, test.parent)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package zetascan
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
@@ -9,14 +14,63 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
 )
 
+// Zetascan end points
+const (
+	// EndpointAPI is a bit faster, but you may hit a server with high load or currently not functioning
+	EndpointAPI = "api.zetascan.com"
+	// EndpointRestLB is load balanced and highly available, a bit slower but guarantees a response
+	EndpointRestLB = "restlb.zetascan.com"
+	// EndpointDNSLB is the experimental DNS load balanced and highly available end point
+	EndpointDNSLB = "dnslb.zetascan.com"
+)
+
+// Errors returned by Query and Ping, check with errors.Is
+var (
+	ErrInvalidRequest    = errors.New("Invalid request, check URL not malformed")
+	ErrForbidden         = errors.New("Request forbidden, check API key or IP for authorization")
+	ErrRateLimited       = errors.New("Too many requests, query quota exceeded")
+	ErrUnreachable       = errors.New("zetascan unreachable")
+	ErrDNSFailure        = errors.New("DNS lookup failed")
+	ErrBodyTooLarge      = errors.New("response body exceeds the maximum size")
+	ErrUnsupportedMethod = errors.New("unsupported query method")
+	ErrNoReason          = errors.New("no listing reason, only returned by the jsonx method and dns TXT answers")
+	ErrEmptyQuery        = errors.New("empty query")
+	ErrQueryTooLong      = errors.New("query too long")
+	ErrInvalidURL        = errors.New("invalid URL")
+	ErrCircuitOpen       = errors.New("circuit breaker open, endpoint failing")
+	ErrInvalidHash       = errors.New("invalid hash")
+	ErrClosed            = errors.New("api closed")
+)
+
+// DefaultMaxBodySize is the response body limit, reputation responses are tiny
+const DefaultMaxBodySize = 256 << 10
+
+// DefaultMaxQueryLength is the query length limit, the longest valid domain name (RFC 1035)
+const DefaultMaxQueryLength = 253
+
+// DefaultUserAgent identifies this client in the provider's logs
+const DefaultUserAgent = "go-zetascan/2"
+
+// Methods lists every supported query method
+var Methods = []string{"text", "http", "json", "jsonx", "dns"}
+
 // Api struct for key, URL and method
+//
+// Configure an Api first (Init, the exported fields, the With options), then share it freely: the query
+// methods use value receivers and only read the configuration, so any number of goroutines may
+// call Query on the same Api. Shared state such as the Dedupe group is synchronized internally.
+// Changing the configuration while queries are in flight is a data race, configure a copy instead.
 type Api struct {
 	apiKey      string
 	apiURL      string
@@ -25,60 +79,219 @@ type Api struct {
 	apiProtocol string
 	DnsMethod   string
 	DnsType     string
+
+	// MaxBodySize caps the response body read, in bytes (DefaultMaxBodySize if zero)
+	MaxBodySize int64
+
+	// MaxQueryLength caps the queried item, in bytes (DefaultMaxQueryLength if zero, negative disables)
+	MaxQueryLength int
+
+	// Params are extra query parameters added to every web query URL (e.g. cats=dbl)
+	Params url.Values
+
+	// DohURL is the DNS-over-HTTPS endpoint used when DnsMethod is "doh"
+	DohURL string
+
+	// DnsEndpoint is the nameserver host (optionally host:port) queried by the dns method
+	DnsEndpoint string
+
+	// DnsRetries is the number of timed out DNS exchanges retried by Query and QueryDNSContext, with
+	// the WithRetry backoff (or its defaults) between attempts
+	DnsRetries int
+
+	// DnsZone is the list zone appended to items by the dns method, e.g. a per-list zone. Empty (the
+	// default) looks up the bare item at DnsEndpoint, the zetascan v1 DNS format.
+	DnsZone string
+
+	// Concurrency limits the number of in-flight lookups for batch queries
+	Concurrency int
+
+	// Timeout is the max time to a verdict, bounding each Query/QueryDNS call whether it goes over
+	// HTTP, DoH or DNS (retries included). A tighter caller deadline still wins, zero means no limit.
+	Timeout time.Duration
+
+	// BlackListPrecedence lets a blacklist hit override a whitelist hit in Verdict
+	BlackListPrecedence bool
+
+	// IgnoreSubnet makes Verdict ignore listings of the containing subnet rather than the exact IP
+	IgnoreSubnet bool
+
+	// Dedupe shares one lookup between concurrent identical queries (same item and configuration)
+	Dedupe bool
+	group  *singleflight.Group
+
+	// UserAgent is sent with every outbound request (DefaultUserAgent, Go's default if empty)
+	UserAgent string
+
+	// Resolves the PTR of queried IPs when set, see WithReverseDNS
+	resolver *net.Resolver
+
+	// The subnet parameter sent with IP queries, see WithSubnetLookup
+	subnet string
+
+	// Starts a span around each query when set, see WithTracer
+	tracer Tracer
+
+	// Results cache shared by copies of this Api, see WithCache
+	cache *resultCache
+
+	// Fall back to the dns method when the web endpoint is unreachable, see WithFallback
+	fallbackDNS bool
+
+	// Fails web queries fast while the endpoint is down, see WithCircuitBreaker
+	breaker *circuitBreaker
+
+	// Retries of failed web queries, see WithRetry
+	retry retryPolicy
+
+	// Hot cache entries refreshed in the background, see WithCacheRefresh
+	refreshHot   int
+	refreshAhead time.Duration
+
+	// Sent with every outbound request, see SetHeader
+	headers http.Header
+
+	// Authenticate via the IP address instead of the API key, see Init
+	ipAuth bool
+
+	// Send the API key in this header instead of the URL, see WithHeaderAuth
+	authHeader string
+
+	// Rotating API keys, see WithKeys
+	keys *keyRing
+
+	// Transport options, see WithTLSConfig, WithProxy and WithHTTPClient
+	tlsConfig    *tls.Config
+	proxyURL     *url.URL
+	proxyDial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	client       *http.Client
+	customClient *http.Client
+
+	// Debug records the raw request/response of HTTP queries, see LastExchange
+	Debug     bool
+	exchanges *exchangeLog
+
+	// Nanoseconds taken by the latest query, see LastDuration
+	lastDuration *int64
+
+	// Set to 1 by Close, shared by every copy
+	closed *int32
 }
 
+// Query is a single lookup for DoQuery: the item, and optionally an API key for this call only
 type Query struct {
-	apiKey   string
-	apiQuery string
+	ApiKey   string
+	ApiQuery string
 }
 
-// Format for JSON and JSONX responses
+// Format for JSON and JSONX responses, the xml method shares the same shape
 
 type JsonReason struct {
-	Class       string `json:"class"`
-	Rule        string `json:"rule"`
-	Type        string `json:"type"`
-	Name        string `json:"name"`
-	Source      string `json:"source"`
-	Port        string `json:"port"`
-	SourcePort  string `json:"sourceport"`
-	Destination string `json:"destination"`
+	Class       string `json:"class" xml:"class"`
+	Rule        string `json:"rule" xml:"rule"`
+	Type        string `json:"type" xml:"type"`
+	Name        string `json:"name" xml:"name"`
+	Source      string `json:"source" xml:"source"`
+	Port        string `json:"port" xml:"port"`
+	SourcePort  string `json:"sourceport" xml:"sourceport"`
+	Destination string `json:"destination" xml:"destination"`
 }
 
 type JsonExtended struct {
-	ASNum   string     `json:"ASNum"`
-	Route   string     `json:"route"`
-	Country string     `json:"country"`
-	Domain  string     `json:"domain"`
-	State   string     `json:"state"`
-	Time    string     `json:"time"`
-	Reason  JsonReason `json:"reason"`
+	ASNum   string     `json:"ASNum" xml:"ASNum"`
+	Route   string     `json:"route" xml:"route"`
+	Country string     `json:"country" xml:"country"`
+	Domain  string     `json:"domain" xml:"domain"`
+	State   string     `json:"state" xml:"state"`
+	Time    string     `json:"time" xml:"time"`
+	Reason  JsonReason `json:"reason" xml:"reason"`
 }
 
 type JsonResults []struct {
-	Item       string       `json:"item"`
-	Found      bool         `json:"found"`
-	Score      float64      `json:"score"`
-	WebScore   float64      `json:"webscore"`
-	FromSubnet bool         `json:"fromSubnet"`
-	Sources    []string     `json:"sources"`
-	Wl         bool         `json:"wl"`
-	Wldata     string       `json:"wldata"`
-	Extended   JsonExtended `json:"extended"`
+	Item       string       `json:"item" xml:"item"`
+	Found      bool         `json:"found" xml:"found"`
+	Score      float64      `json:"score" xml:"score"`
+	WebScore   float64      `json:"webscore" xml:"webscore"`
+	FromSubnet bool         `json:"fromSubnet" xml:"fromSubnet"`
+	Sources    []string     `json:"sources" xml:"sources>source"`
+	Wl         bool         `json:"wl" xml:"wl"`
+	Wldata     string       `json:"wldata" xml:"wldata"`
+	Extended   JsonExtended `json:"extended" xml:"extended"`
 }
 
 type JsonRecord struct {
-	Results       JsonResults `json:"results"`
-	ExecutionTime int64       `json:"executionTime"`
-	Status        string      `json:"status"`
+	Results       JsonResults `json:"results" xml:"results>result"`
+	ExecutionTime int64       `json:"executionTime" xml:"executionTime"` // milliseconds, see Query
+	Status        string      `json:"status" xml:"status"`
+
+	// Headers holds every x-zetascan-* response header (lower cased keys), http method only
+	Headers map[string]string `json:"headers,omitempty" xml:"-"`
+
+	// ReturnCodes holds the raw 127.x.x.x answers the verdict was built from, dns method only
+	ReturnCodes []net.IP `json:"returnCodes,omitempty" xml:"-"`
+
+	// DNSWL holds the trust level and category decoded from a 127.8.C.T answer (the highest trust
+	// if several), nil without one, dns method only
+	DNSWL *DNSWL `json:"dnswl,omitempty" xml:"-"`
+}
+
+// String returns a one line summary of the first result for logging, e.g.
+// item=baddomain.org found=true wl=false score=1 sources=[dbl red]
+func (record JsonRecord) String() string {
+
+	if len(record.Results) == 0 {
+		return "status=" + record.Status + " no results"
+	}
+
+	result := record.Results[0]
+
+	return fmt.Sprintf("item=%s found=%t wl=%t score=%s sources=%v",
+		result.Item, result.Found, result.Wl, strconv.FormatFloat(result.Score, 'f', -1, 64), result.Sources)
+}
+
+// newRecord returns a record holding a single empty result
+func newRecord() JsonRecord {
+	return JsonRecord{Results: make(JsonResults, 1)}
 }
 
+// Status values synthesized for methods (text, dns) that don't return one
+const (
+	StatusSuccess  = "success"
+	StatusNotFound = "notfound"
+)
+
+// Results summarizes a single Verify test
 type Results struct {
-	IP          string
-	Match       bool
-	Expected    bool
-	TimeElapsed int64
-	Length      int
+	IP          string `json:"ip"`
+	Match       bool   `json:"match"`
+	Expected    bool   `json:"expected"`
+	TimeElapsed int64  `json:"timeElapsed"`
+	Length      int    `json:"length"`
+
+	// Reason explains the verdict (e.g. the sources an item was found in) or the query error
+	Reason string `json:"reason,omitempty"`
+}
+
+// Passed reports if the test matched its expected listing
+func (result Results) Passed() bool {
+	return result.Match == result.Expected
+}
+
+// MarshalJSON adds a readable "verdict" (pass/fail) to the JSON encoding
+func (result Results) MarshalJSON() ([]byte, error) {
+
+	// Alias drops the MarshalJSON method, avoiding recursion
+	type alias Results
+
+	verdict := "fail"
+	if result.Passed() {
+		verdict = "pass"
+	}
+
+	return json.Marshal(struct {
+		alias
+		Verdict string `json:"verdict"`
+	}{alias(result), verdict})
 }
 
 // Init specify an authentication key for authentication
@@ -92,56 +305,345 @@ func (myapi Api) Init(apiKey string, ipcheck bool) (myapi2 Api, err error) {
 	// TODO: Change to new zetascan URL
 	// a.	restlb.zetascan.com – load balanced and high availability end point – a bit slower, but guarantees 100% response rate.
 	// b.	api.zetascan.com – a bit faster. However, you may hit a server with high load or currently not functioning. You should handle this and issue another request.
-	// c.	dnslb.zetasca.com – experimental DNS Load balancer and high availability end point.
+	// c.	dnslb.zetascan.com – experimental DNS Load balancer and high availability end point.
 
-	myapi.apiURL = "api.zetascan.com"
+	myapi.apiURL = EndpointAPI
 	myapi.apiProtocol = myapi.ToggleSSL(true) // Default to SSL
 	myapi.ApiMethod = "http"
 
 	// Version bump from v1 to v2 for Zetascan v2 release
 	myapi.apiVersion = "v2"
 
-	// DNS has two methods, direct or
+	// DNS has two methods, direct to the nameserver or DNS-over-HTTPS ("doh")
 	myapi.DnsMethod = "nameserver"
+	myapi.DohURL = "https://api.zetascan.com/dns-query"
+
+	// Set to EndpointDNSLB for the DNS load balancer
+	myapi.DnsEndpoint = EndpointAPI
 
 	// Support lookups with A records or txt
 	myapi.DnsType = "A"
+	myapi.DnsRetries = DefaultDNSRetry
+
+	// Batch queries run a few lookups in parallel
+	myapi.Concurrency = 4
+
+	myapi.MaxBodySize = DefaultMaxBodySize
+	myapi.MaxQueryLength = DefaultMaxQueryLength
+	myapi.UserAgent = DefaultUserAgent
+
+	// Shared by every copy of this Api, only used when Dedupe/Debug are set
+	myapi.group = new(singleflight.Group)
+	myapi.exchanges = new(exchangeLog)
+	myapi.lastDuration = new(int64)
+	myapi.closed = new(int32)
+
+	myapi.ipAuth = ipcheck
 
 	// Check if https required
-	if myapi.apiProtocol == "http" && apiKey != "" && ipcheck == false {
-		return myapi, errors.New("https required if using API key without ip check")
+	if err := myapi.validate(); err != nil {
+		return myapi, err
 	}
 
 	return myapi, nil
 }
 
-// Query a domain/IP via any method (text, html, json, jsonx, dns)
+// Clone returns a copy of the Api whose configuration (Params, headers, TLS settings) can be
+// changed without affecting the original. Runtime state is shared with the original: the Dedupe
+// group, the WithCache results, the key ring's usage and benching, the Debug exchange log and the
+// HTTP client's pool.
+func (myapi Api) Clone() *Api {
+
+	clone := myapi
+
+	if myapi.Params != nil {
+		clone.Params = make(url.Values, len(myapi.Params))
+
+		for param, values := range myapi.Params {
+			clone.Params[param] = append([]string(nil), values...)
+		}
+	}
+
+	clone.headers = myapi.headers.Clone()
+
+	if myapi.tlsConfig != nil {
+		clone.tlsConfig = myapi.tlsConfig.Clone()
+	}
+
+	return &clone
+}
+
+// Close stops the background cache refresher, clears the cache and marks the Api closed: queries
+// from it or any copy then fail with ErrClosed, a closed Api can't be reused. Queries in flight
+// complete. Close is idempotent and always returns nil.
+func (myapi Api) Close() error {
+
+	if myapi.closed != nil && atomic.SwapInt32(myapi.closed, 1) == 1 {
+		return nil
+	}
+
+	// Closing the cache first keeps a concurrent Start from running past Stop
+	myapi.cache.close()
+	myapi.Stop()
+
+	return nil
+}
+
+// isClosed reports if Close was called
+func (myapi Api) isClosed() bool {
+	return myapi.closed != nil && atomic.LoadInt32(myapi.closed) == 1
+}
+
+// validate checks the API key can't leak: https is required if using an API key without ip check,
+// unless client certificates authenticate instead (the key is then never sent)
+func (myapi Api) validate() error {
+
+	if myapi.apiProtocol == "http" && myapi.apiKey != "" && myapi.ipAuth == false && myapi.mutualTLS() == false {
+		return errors.New("https required if using API key without ip check")
+	}
+
+	return nil
+}
+
+// Query a domain/IP via any method (text, http, json, jsonx, dns). The record's ExecutionTime is in
+// milliseconds: the server's execution time when the json/jsonx/xml response has one, otherwise the
+// client round trip.
 func (myapi Api) Query(query string) (m JsonRecord, err error) {
 
-	// If DNS, run a specific function, otherwise all web queries via http.Get
+	return myapi.QueryContext(context.Background(), query)
+
+}
+
+// DoQuery queries q.ApiQuery, with q.ApiKey instead of the configured key(s) when set
+func (myapi Api) DoQuery(q Query) (m JsonRecord, err error) {
+
+	if q.ApiKey != "" {
+
+		if myapi, err = myapi.WithKey(q.ApiKey); err != nil {
+			return m, err
+		}
+
+	}
+
+	return myapi.Query(q.ApiQuery)
+}
+
+// QueryHash queries a content hash (e.g. of a message body): an MD5, SHA-1 or SHA-256 hex digest,
+// sent lower cased in place of the item. Anything else fails with ErrInvalidHash.
+func (myapi Api) QueryHash(hash string) (m JsonRecord, err error) {
+
+	hash = strings.ToLower(strings.TrimSpace(hash))
+
+	if _, err := hex.DecodeString(hash); err != nil {
+		return m, fmt.Errorf("%w: not hex", ErrInvalidHash)
+	}
+
+	switch len(hash) {
+	case 32, 40, 64:
+	default:
+		return m, fmt.Errorf("%w: %d hex digits, expected 32 (MD5), 40 (SHA-1) or 64 (SHA-256)", ErrInvalidHash, len(hash))
+	}
+
+	return myapi.Query(hash)
+}
+
+// QueryURL queries the host of a full URL, e.g. bad.example.com for https://bad.example.com/path?x=1
+// (any port or userinfo is dropped). A URL without a host fails with ErrInvalidURL.
+func (myapi Api) QueryURL(rawurl string) (m JsonRecord, err error) {
+
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+
+	if err != nil {
+		return m, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if u.Hostname() == "" {
+		return m, fmt.Errorf("%w: no host in %q", ErrInvalidURL, rawurl)
+	}
+
+	return myapi.Query(u.Hostname())
+}
+
+// QueryContext queries like Query, aborting when ctx is done. When Timeout is set the
+// lookup is additionally bounded by it, whichever deadline comes first wins.
+func (myapi Api) QueryContext(ctx context.Context, query string) (m JsonRecord, err error) {
+
+	if myapi.isClosed() {
+		return m, ErrClosed
+	}
+
+	// Reject an empty or oversized item before building a malformed URL
+	if query, err = myapi.checkQuery(query); err != nil {
+		return m, err
+	}
+
+	if myapi.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, myapi.Timeout)
+		defer cancel()
+	}
+
+	// Trace the query, see WithTracer
+	ctx, span := myapi.startSpan(ctx, query)
+	defer func() { endSpan(span, err) }()
+
+	defer myapi.recordDuration(time.Now())
+
+	key := myapi.lookupKey(query)
+
+	// Answer from the cache while the result is fresh, see WithCache
+	if m, ok := myapi.cache.get(key); ok {
+		return m, nil
+	}
+
+	if m, err = myapi.lookup(ctx, key, query); err == nil {
+		myapi.reverseDNS(ctx, query, &m)
+		myapi.cache.put(key, m, myapi, query)
+	}
+
+	return m, err
+
+}
+
+// lookupKey identifies the lookup of query for the cache and Dedupe: copies of an Api configured
+// differently (endpoint, method, subnet, params, DNS name or server, key, reverse DNS) don't share
+// results
+func (myapi Api) lookupKey(query string) string {
+
+	target := myapi.getUrl(query)
+
+	if myapi.ApiMethod == "dns" {
+
+		server := myapi.dnsServer()
+
+		if myapi.DnsMethod == "doh" {
+			server = myapi.DohURL
+		}
+
+		question := myapi.dnsMsg(query).Question[0]
+		target = "dns://" + server + "/" + question.Name + " " + dns.TypeToString[question.Qtype]
+	}
+
+	return fmt.Sprintf("%s key=%s resolver=%p", target, myapi.apiKey, myapi.resolver)
+}
+
+// lookup queries via the network, sharing the lookup between concurrent callers when Dedupe is set
+func (myapi Api) lookup(ctx context.Context, key string, query string) (m JsonRecord, err error) {
+
+	if myapi.Dedupe == false || myapi.group == nil {
+		return myapi.query(ctx, query)
+	}
+
+	// Concurrent callers for the same lookup wait on a single one, and share its error.
+	// The lookup runs under the context of the caller that started it.
+	v, err, _ := myapi.group.Do(key, func() (interface{}, error) {
+		return myapi.query(ctx, query)
+	})
+
+	m = v.(JsonRecord)
+
+	// Give each caller its own Results slice
+	m.Results = append(JsonResults(nil), m.Results...)
+
+	return m, err
+
+}
+
+// query performs a single lookup via the configured method
+func (myapi Api) query(ctx context.Context, query string) (m JsonRecord, err error) {
+
+	start := time.Now()
+
+	// If DNS, run a specific function, otherwise all web queries via HTTP GET
 	if myapi.ApiMethod == "dns" {
-		results, _ := myapi.QueryDNS(query, 3)
-		m, _ = myapi.ParseDNS(results)
+		results, txt, err := myapi.queryDNS(ctx, query, myapi.DnsRetries)
+
+		if err != nil {
+			return m, err
+		}
+
+		m, _ = myapi.ParseDNS(results, txt...)
 
 	} else {
-		res, err := http.Get(myapi.getUrl(query))
+
+		// The endpoint is failing, fail fast instead of waiting on it, see WithCircuitBreaker
+		if myapi.breaker.allow() == false {
+			return myapi.fallback(ctx, query, ErrCircuitOpen)
+		}
+
+		var res *http.Response
+
+		for attempt := 0; ; attempt++ {
+
+			// Rotating keys, each attempt of this copy of the Api queries with the next one
+			if myapi.keys != nil {
+				myapi.apiKey = myapi.keys.take()
+			}
+
+			req, err := myapi.newQueryRequest(ctx, query)
+
+			if err != nil {
+				return m, err
+			}
+
+			res, err = myapi.do(req)
+
+			if err == nil {
+				recordStatus(ctx, res.StatusCode)
+			}
+
+			// Forbidden or over quota? Bench a rotating key and try the next one straight away, this
+			// attempt doesn't count against the retry budget
+			if err == nil && (res.StatusCode == 403 || res.StatusCode == 429) && myapi.keys != nil && myapi.keys.bench(myapi.apiKey) {
+				res.Body.Close()
+				attempt--
+				continue
+			}
+
+			// Out of attempts, or not worth another one? Handle this response
+			if attempt >= myapi.retry.retries || myapi.retryable(ctx, res, err) == false {
+
+				// A caller giving up says nothing about the endpoint
+				if errors.Is(err, context.Canceled) == false {
+					myapi.breaker.record(err == nil && res.StatusCode < 500)
+				}
+
+				// Network failure, there is no response to inspect
+				if err != nil {
+					return myapi.fallback(ctx, query, err)
+				}
+
+				break
+			}
+
+			if res != nil {
+				res.Body.Close()
+			}
+
+			if err := myapi.retry.wait(ctx, attempt); err != nil {
+				return m, err
+			}
+
+		}
+
+		defer res.Body.Close()
 
 		// URL malformed? Return an error
 		if res.StatusCode == 404 {
-			return m, errors.New("Invalid request, check URL not malformed: " + myapi.getUrl(query))
+			return m, fmt.Errorf("%w: %s", ErrInvalidRequest, myapi.redactedUrl(query))
 		}
 
-		// Forbidden? Return an error
+		// Forbidden or over quota? Return an error
 		if res.StatusCode == 403 {
-			return m, errors.New("Request forbidden, check API key or IP for authorization: " + myapi.getUrl(query))
+			return m, fmt.Errorf("%w: %s", ErrForbidden, myapi.redactedUrl(query))
 		}
 
-		//fmt.Println(myapi.getUrl(query), res, err)
-
-		if err != nil {
-			return m, err
+		if res.StatusCode == 429 {
+			return m, fmt.Errorf("%w: %s", ErrRateLimited, myapi.redactedUrl(query))
 		}
 
+		//fmt.Println(myapi.getUrl(query), res, err)
+
 		m, err = myapi.parseResult(res)
 
 		//fmt.Println(err)
@@ -152,13 +654,97 @@ func (myapi Api) Query(query string) (m JsonRecord, err error) {
 
 	}
 
+	// The json methods report the server's execution time, the others the client round trip
+	if m.ExecutionTime == 0 {
+		m.ExecutionTime = time.Since(start).Milliseconds()
+	}
+
 	return m, nil
 
 }
 
+// fallback queries via the dns method after the web query failed with err, see WithFallback
+func (myapi Api) fallback(ctx context.Context, query string, err error) (JsonRecord, error) {
+
+	if myapi.fallbackDNS == false || ctx.Err() != nil {
+		return JsonRecord{}, err
+	}
+
+	myapi.ApiMethod = "dns"
+
+	m, dnsErr := myapi.query(ctx, query)
+
+	if dnsErr != nil {
+		return m, fmt.Errorf("%w (dns fallback: %v)", err, dnsErr)
+	}
+
+	return m, nil
+}
+
+// QueryAll runs the query through every method in Methods and returns the records keyed by
+// method name, useful to compare how each format reports the same item. A failing method
+// doesn't abort the others, it is left out of the map and reported in the returned error.
+func (myapi Api) QueryAll(query string) (records map[string]JsonRecord, err error) {
+
+	records = make(map[string]JsonRecord)
+
+	var failed []string
+
+	for _, method := range Methods {
+
+		myapi.ApiMethod = method
+
+		m, err := myapi.Query(query)
+
+		if err != nil {
+			failed = append(failed, method+": "+err.Error())
+			continue
+		}
+
+		records[method] = m
+
+	}
+
+	if len(failed) > 0 {
+		return records, errors.New("query failed for " + strings.Join(failed, "; "))
+	}
+
+	return records, nil
+
+}
+
+// Ping checks connectivity and authorization with a lookup of the okdomain.org test record via the
+// configured method. Failures wrap ErrForbidden for auth errors, otherwise ErrUnreachable.
+func (myapi Api) Ping(ctx context.Context) error {
+
+	m, err := myapi.QueryContext(ctx, "okdomain.org")
+
+	if errors.Is(err, ErrForbidden) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+
+	if m.Status != StatusSuccess && m.Status != StatusNotFound {
+		return fmt.Errorf("%w: unexpected status %q", ErrUnreachable, m.Status)
+	}
+
+	return nil
+
+}
+
 // Verify a query to zetascan is returning valid data
 func (myapi Api) Verify(status bool, verbose bool) (totalResults []Results, err error) {
 
+	return myapi.verify(DefaultVerifyTests(), verbose)
+}
+
+// DefaultVerifyTests returns the test records run by Verify, mapping each to whether it is expected
+// to be blacklisted (matched). The map is a fresh copy, extend it for VerifyWith.
+func DefaultVerifyTests() map[string]bool {
+
 	tests := make(map[string]bool)
 
 	// Records that will pass (whitelist)
@@ -171,121 +757,191 @@ func (myapi Api) Verify(status bool, verbose bool) (totalResults []Results, err
 	tests["127.9.9.2"] = true
 	tests["127.9.9.3"] = true
 
-	//for i := 0; i < len(tests); i++ {
-	for key, value := range tests {
+	return tests
+}
 
-		if verbose == true {
-			fmt.Println("Testing", key, value)
-		}
+// VerifyWith runs the Verify checks against a custom test set, mapping each record to whether it
+// is expected to be blacklisted (matched)
+func (myapi Api) VerifyWith(tests map[string]bool) (totalResults []Results, err error) {
 
-		// Time the query length
-		startTime := time.Now()
+	return myapi.verify(tests, false)
+}
 
-		// Fetch the result
-		response, err := myapi.Query(key)
+// verify queries the test records, at most Concurrency at a time, and compares each match with the
+// expected result. The results are sorted by item.
+func (myapi Api) verify(tests map[string]bool, verbose bool) (totalResults []Results, err error) {
 
-		m := time.Duration(time.Since(startTime))
-		durationTime := int64(m / time.Millisecond)
+	keys := make([]string, 0, len(tests))
 
-		if verbose == true {
-			fmt.Println("Response =>", response)
-		}
+	for key := range tests {
+		keys = append(keys, key)
+	}
 
-		if err != nil {
-			fmt.Println(err)
-		}
+	sort.Strings(keys)
 
-		// Does it match?
-		match := myapi.IsMatch(&response)
+	// Each test writes its own slot, keeping the order deterministic
+	totalResults = make([]Results, len(keys))
 
-		/*
-			if match == true && value != true {
-				fmt.Println(key, ": Failed (", durationTime, ")")
-			}
+	sem := make(chan struct{}, myapi.workers())
 
-			if match == true {
-				fmt.Println(key, ": Matched (", durationTime, ")")
-			} else {
-				fmt.Println(key, ": No hit (", durationTime, ")")
-			}
+	var wg sync.WaitGroup
 
-			if verbose == true {
-				fmt.Println("Resp => ", res, "\n")
-			}
-		*/
+	for i, key := range keys {
 
-		// Store the results and return the group in a struct, regardless of the method
-		result := Results{
-			IP:          key,
-			TimeElapsed: durationTime,
-			Match:       match,
-			Expected:    value,
-		}
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-		// Append each result
-		totalResults = append(totalResults, result)
+			totalResults[i] = myapi.verifyOne(key, tests[key], verbose)
+		}(i, key)
 
 	}
 
+	wg.Wait()
+
 	// Return all matches
 	return totalResults, nil
 }
 
+// verifyOne queries a single test record, expected to be matched or not
+func (myapi Api) verifyOne(key string, value bool, verbose bool) Results {
+
+	if verbose == true {
+		fmt.Println("Testing", key, value)
+	}
+
+	// Time the query length
+	startTime := time.Now()
+
+	// Fetch the result
+	response, err := myapi.Query(key)
+
+	m := time.Duration(time.Since(startTime))
+	durationTime := int64(m / time.Millisecond)
+
+	if verbose == true {
+		fmt.Println("Response =>", response)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	// Does it match? Explain the listing, or why the query failed
+	var match bool
+	var reason string
+
+	if err != nil {
+		reason = err.Error()
+	} else {
+		match = myapi.IsMatch(&response)
+		_, reason = myapi.Verdict(&response)
+	}
+
+	/*
+		if match == true && value != true {
+			fmt.Println(key, ": Failed (", durationTime, ")")
+		}
+
+		if match == true {
+			fmt.Println(key, ": Matched (", durationTime, ")")
+		} else {
+			fmt.Println(key, ": No hit (", durationTime, ")")
+		}
+
+		if verbose == true {
+			fmt.Println("Resp => ", res, "\n")
+		}
+	*/
+
+	// Store the results and return the group in a struct, regardless of the method
+	result := Results{
+		IP:          key,
+		TimeElapsed: durationTime,
+		Match:       match,
+		Expected:    value,
+		Reason:      reason,
+	}
+
+	return result
+}
+
 // getUrl Return a URL to query zetascan
 func (myapi Api) getUrl(domain string) string {
 
 	// Encode the apiKey if specified
 	v := url.Values{}
 
-	// If the API key is specified, add the query URI
-	if myapi.apiKey != "" {
+	// Extra parameters first, so they can't override the key
+	for param, values := range myapi.Params {
+		v[param] = append([]string(nil), values...)
+	}
+
+	// Subnet-level listings only apply to IPs, a domain query is sent without the parameter
+	if myapi.subnet != "" && net.ParseIP(domain) != nil {
+		v.Set("subnet", myapi.subnet)
+	}
+
+	// If the API key is specified, add the query URI. Client certificates replace the key, header auth moves it.
+	if myapi.apiKey != "" && myapi.mutualTLS() == false && myapi.authHeader == "" {
 		v.Set("key", myapi.apiKey)
 	}
 
-	// TODO: Improve
-	str := myapi.apiProtocol + "://" + myapi.apiURL + "/" + myapi.apiVersion + "/check/" + myapi.ApiMethod + "/" + domain + "?" + v.Encode()
+	// The item is escaped as a single path segment, the trailing "?" is kept when there are no parameters
+	path := "/" + myapi.apiVersion + "/check/" + myapi.ApiMethod + "/"
 
-	return str
+	u := url.URL{
+		Scheme:     myapi.apiProtocol,
+		Host:       myapi.apiURL,
+		Path:       path + domain,
+		RawPath:    path + url.PathEscape(domain),
+		RawQuery:   v.Encode(),
+		ForceQuery: true,
+	}
+
+	return u.String()
+}
+
+// redactedUrl returns the getUrl of query with the API key redacted, for error messages
+func (myapi Api) redactedUrl(query string) string {
+
+	u, err := url.Parse(myapi.getUrl(query))
+
+	if err != nil {
+		return ""
+	}
+
+	return redactURL(u).String()
 }
 
 // parseResult returns a struct with the zetascan response, regardless of the query method
 func (myapi Api) parseResult(resp *http.Response) (data JsonRecord, err error) {
 
-	// Init our object (Results is a []struct must be manually created)
-	data = JsonRecord{
-		Results: []struct {
-			Item       string       `json:"item"`
-			Found      bool         `json:"found"`
-			Score      float64      `json:"score"`
-			WebScore   float64      `json:"webscore"`
-			FromSubnet bool         `json:"fromSubnet"`
-			Sources    []string     `json:"sources"`
-			Wl         bool         `json:"wl"`
-			Wldata     string       `json:"wldata"`
-			Extended   JsonExtended `json:"extended"`
-		}{
-			{},
-		},
-	}
+	// Init our object, the predicates expect one result
+	data = newRecord()
 
 	// Read the response
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := myapi.readBody(resp.Body)
 
 	if err != nil {
 		return data, err
 	}
-	// Choose which method use (http, text, json/jsonx)
-	switch myapi.ApiMethod {
 
-	case "http":
-		{
+	// No content means not listed whatever the method, there is no body to parse. The http
+	// method still reads its headers, which carry the item and timing.
+	if resp.StatusCode == http.StatusNoContent && myapi.ApiMethod != "http" {
+		data.Status = StatusNotFound
+		return data, nil
+	}
 
-			if resp.StatusCode == 204 {
-				data.Results[0].Found = false
-			} else {
+	// Choose which method use (http, text, json/jsonx)
+	switch myapi.ApiMethod {
 
-				//data.Results[0].Found = true
-			}
+	case "http":
+		{
 
 			/*
 			   Sample header response:
@@ -311,12 +967,23 @@ func (myapi Api) parseResult(resp *http.Response) (data JsonRecord, err error) {
 			   x-zetascan-wl:null
 			*/
 
+			// Keep every zetascan header, including any the parser doesn't know about yet
+			data.Headers = make(map[string]string)
+
+			for key := range resp.Header {
+				if name := strings.ToLower(key); strings.HasPrefix(name, "x-zetascan-") {
+					data.Headers[name] = resp.Header.Get(key)
+				}
+			}
+
 			// Populate our struct with details of the request
-			data.Results[0].Score, _ = strconv.ParseFloat(resp.Header.Get("x-zetascan-score"), 32)
-			data.Results[0].WebScore, _ = strconv.ParseFloat(resp.Header.Get("x-zetascan-webscore"), 32)
+			data.Results[0].Score, _ = strconv.ParseFloat(resp.Header.Get("x-zetascan-score"), 64)
+			data.Results[0].WebScore, _ = strconv.ParseFloat(resp.Header.Get("x-zetascan-webscore"), 64)
 
 			// Populate our struct with details of the request
-			data.Results[0].Sources = strings.Split(";", resp.Header.Get("x-zetascan-sources"))
+			if sources := resp.Header.Get("x-zetascan-sources"); sources != "" {
+				data.Results[0].Sources = strings.Split(sources, ";")
+			}
 
 			// TODO: Clarify, since JSON wl and wl-data differ from HTTP query
 			//wl := resp.Header.Get("x-zetascan-wl")
@@ -331,7 +998,9 @@ func (myapi Api) parseResult(resp *http.Response) (data JsonRecord, err error) {
 			// Todo, Split based on ; similar to Sources?
 			data.Results[0].Wldata = resp.Header.Get("x-zetascan-wl")
 
-			data.Status = resp.Header.Get("x-zetascan-success")
+			// x-zetascan-time is a Unix timestamp (see the sample above) rather than a duration, it is
+			// left in Headers and the execution time is measured by the client
+			data.Status = resp.Header.Get("x-zetascan-status")
 
 			// TODO: Workaround, since HTTP missing the found header
 			if data.Results[0].Wl == true {
@@ -340,108 +1009,321 @@ func (myapi Api) parseResult(resp *http.Response) (data JsonRecord, err error) {
 				data.Results[0].Found = true
 			}
 
-		}
+			// No status header (e.g. 204), synthesize one like text/dns
+			if data.Status == "" {
+				data.Status = syntheticStatus(&data)
+			}
 
-	case "text":
-		{
+			// The queried item(s), one result per item sharing the header values
+			if items := resp.Header.Get("x-zetascan-items"); items != "" {
 
-			// Read the body and split from the specified API formatting
-			bodyString := string(body)
-			head := strings.Split(bodyString, ":")
-			str := strings.Split(head[1], ",")
+				result := data.Results[0]
+				data.Results = data.Results[:0]
 
-			/*
-				http://docs.zetascan.io/?php#http-format
-				item:bool,bool,wldata,score,source
+				for _, item := range strings.Split(items, ";") {
+					result.Item = item
+					data.Results = append(data.Results, result)
+				}
 
-				Where:
+			}
 
-				the first bool is true, if found in any black list,
-				the second bool is true, if found in any white list,
-				wldata contains the data from the white list, and
-				score is followed by the list of sources where the item was found.
+		}
 
-				Updated for v2
+	case "text":
+		{
+			if data, err = parseText(body); err != nil {
+				return data, err
+			}
+		}
 
-				baddomain.org:true,false,,1,0.6,dbl,red,gold,grey,black okdomain.org:true,true,,-0.1,-0.1,white 127.9.9.1:true,false,,0.95,0.6,xbl,sbl
+	case "json", "jsonx":
+		{
+			if data, err = parseJSON(body); err != nil {
+				return data, fmt.Errorf("invalid %s response: %w", myapi.ApiMethod, err)
+			}
+		}
 
-				okdomain.org:false,true,,-0.1,-0.1,white
+	case "xml":
+		{
 
+			/*
+				The same shape as the JSON format, under any root element:
+
+				<response>
+					<results>
+						<result>
+							<item>baddomain.org</item>
+							<found>true</found>
+							<score>1</score>
+							<sources><source>dbl</source><source>red</source></sources>
+							...
+						</result>
+					</results>
+					<executionTime>2</executionTime>
+					<status>success</status>
+				</response>
 			*/
 
-			// Are we included in a blacklist?
-			if str[0] == "true" {
-				data.Results[0].Found = true
-			} else {
-				data.Results[0].Found = false
-			}
-
-			// Are we included in a whitelist?
-			if str[1] == "true" {
-				data.Results[0].Wl = true
-			} else {
-				data.Results[0].Wl = false
+			// A server without XML support answers with another format, don't mistake it for a clean result
+			if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) == false {
+				return data, fmt.Errorf("%w: xml not supported by the server, got %q", ErrUnsupportedMethod, resp.Header.Get("Content-Type"))
 			}
 
-			data.Results[0].Wldata = str[2]
+			// Unlike encoding/json, encoding/xml appends to the pre-allocated result
+			data.Results = nil
 
-			// TODO: Should be a float32 vs float64
-			data.Results[0].Score, _ = strconv.ParseFloat(str[3], 32)
+			if err := xml.Unmarshal(body, &data); err != nil {
+				return data, fmt.Errorf("invalid %s response: %w", myapi.ApiMethod, err)
+			}
 
-			// TODO: Group together all sources into a response array
-			if len(str) > 3 {
-				//data.Results[0].Sources = str[4:len(str)]
+			if len(data.Results) == 0 {
+				return data, fmt.Errorf("invalid %s response: no results", myapi.ApiMethod)
 			}
 
 		}
 
-	case "json", "jsonx":
+	case "html":
 		{
+			// The html format is a page meant for browsers, with no documented structure to parse
+			return data, fmt.Errorf("%w: html is for browsers, use text, http, json or jsonx", ErrUnsupportedMethod)
+		}
 
-			/*
-				http://docs.zetascan.io/?php#json-format
-
-				Formatting of a JSON response:
-
-				{
-					"results": [{
-					"item": "123.123.123.123",
-					"found": true,
-					"score": 0.2,
-					"fromSubnet": true,
-					"sources": ["shPBL"],
-					"wl": false,
-					"wldata": ""
-					}],
-					"executionTime": 2,
-					"status": "success"
-				}
-			*/
+	default:
+		return data, fmt.Errorf("%w: %q", ErrUnsupportedMethod, myapi.ApiMethod)
 
-			// Decode the JSON response into our defined struct
-			dec := json.NewDecoder(strings.NewReader(string(body)))
-			for {
+	}
 
-				if err := dec.Decode(&data); err == io.EOF {
-					return data, nil
-				} else if err != nil {
-					return data, err
-				}
+	// Every record carries a defined status, a clean result reads StatusNotFound
+	if data.Status == "" {
+		data.Status = syntheticStatus(&data)
+	}
 
-			}
+	return data, nil
+
+}
+
+// ParseJSON decodes a json or jsonx response body read from r, e.g. one received out-of-band
+func ParseJSON(r io.Reader) (JsonRecord, error) {
+
+	body, err := Api{}.readBody(r)
+
+	if err != nil {
+		return newRecord(), err
+	}
+
+	data, err := parseJSON(body)
+
+	if err != nil {
+		return data, fmt.Errorf("invalid json response: %w", err)
+	}
+
+	return data, nil
+}
+
+// ParseText decodes a text response body read from r, e.g. one received out-of-band
+func ParseText(r io.Reader) (JsonRecord, error) {
+
+	body, err := Api{}.readBody(r)
+
+	if err != nil {
+		return newRecord(), err
+	}
+
+	return parseText(body)
+}
+
+// parseJSON decodes a json or jsonx response body
+func parseJSON(body []byte) (data JsonRecord, err error) {
 
+	data = newRecord()
+
+	/*
+		http://docs.zetascan.io/?php#json-format
+
+		Formatting of a JSON response:
+
+		{
+			"results": [{
+			"item": "123.123.123.123",
+			"found": true,
+			"score": 0.2,
+			"fromSubnet": true,
+			"sources": ["shPBL"],
+			"wl": false,
+			"wldata": ""
+			}],
+			"executionTime": 2,
+			"status": "success"
 		}
+	*/
+
+	// Decode the JSON response into our defined struct, the jsonx extended/reason
+	// block is decoded in the same pass. Unknown fields are ignored, missing ones left empty.
+	if err := json.Unmarshal(body, &data); err != nil {
+		return data, err
+	}
+
+	// An empty results array would leave the predicates nothing to check
+	if len(data.Results) == 0 {
+		data.Results = make(JsonResults, 1)
+	}
+
+	if data.Status == "" {
+		data.Status = syntheticStatus(&data)
+	}
+
+	return data, nil
+}
+
+// parseText decodes a text response body
+func parseText(body []byte) (data JsonRecord, err error) {
+
+	data = newRecord()
+
+	// Read the body and split from the specified API formatting
+	bodyString := strings.TrimSpace(string(body))
+	head := strings.Split(bodyString, ":")
+
+	// Expect at least item:found,wl,wldata,score
+	if len(head) < 2 || len(strings.Split(head[1], ",")) < 4 {
+		return data, fmt.Errorf("invalid text response: %q", bodyString)
+	}
+
+	str := strings.Split(head[1], ",")
+
+	/*
+		http://docs.zetascan.io/?php#http-format
+		item:bool,bool,wldata,score,source
+
+		Where:
+
+		the first bool is true, if found in any black list,
+		the second bool is true, if found in any white list,
+		wldata contains the data from the white list, and
+		score is followed by the list of sources where the item was found.
+
+		Updated for v2
+
+		baddomain.org:true,false,,1,0.6,dbl,red,gold,grey,black okdomain.org:true,true,,-0.1,-0.1,white 127.9.9.1:true,false,,0.95,0.6,xbl,sbl
+
+		okdomain.org:false,true,,-0.1,-0.1,white
+
+	*/
+
+	// Are we included in a blacklist?
+	if str[0] == "true" {
+		data.Results[0].Found = true
+	} else {
+		data.Results[0].Found = false
+	}
+
+	// Are we included in a whitelist?
+	if str[1] == "true" {
+		data.Results[0].Wl = true
+	} else {
+		data.Results[0].Wl = false
+	}
+
+	data.Results[0].Wldata = str[2]
+
+	// Parse at float64 precision, as 32 bits turn 0.6 into 0.6000000238
+	data.Results[0].Score, _ = strconv.ParseFloat(str[3], 64)
+
+	// v2 adds the webscore, followed by the sources
+	if len(str) > 4 {
+		data.Results[0].WebScore, _ = strconv.ParseFloat(str[4], 64)
+	}
+
+	if len(str) > 5 {
+		data.Results[0].Sources = str[5:]
+	}
+
+	// The text format has no status field
+	data.Status = syntheticStatus(&data)
+
+	return data, nil
+}
+
+// checkQuery trims query, failing with ErrEmptyQuery or ErrQueryTooLong before any network I/O
+func (myapi Api) checkQuery(query string) (string, error) {
+
+	query = strings.TrimSpace(query)
+
+	if query == "" {
+		return query, ErrEmptyQuery
+	}
+
+	// An IP is always short, this only catches domains and pasted garbage
+	if net.ParseIP(query) != nil {
+		return query, nil
+	}
+
+	limit := myapi.MaxQueryLength
+
+	if limit == 0 {
+		limit = DefaultMaxQueryLength
+	}
+
+	if limit > 0 && len(query) > limit {
+		return query, fmt.Errorf("%w: %d bytes, limit %d", ErrQueryTooLong, len(query), limit)
+	}
+
+	return query, nil
+}
+
+// bodyLimit returns MaxBodySize, DefaultMaxBodySize if unset
+func (myapi Api) bodyLimit() int64 {
+
+	if myapi.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+
+	return myapi.MaxBodySize
+}
+
+// readBody reads a response body, failing with ErrBodyTooLarge past MaxBodySize
+func (myapi Api) readBody(body io.Reader) ([]byte, error) {
+
+	limit := myapi.bodyLimit()
+
+	// Read one byte past the limit to tell a body of exactly limit bytes from a larger one
+	data, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+
+	if err != nil {
+		return nil, err
+	}
 
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrBodyTooLarge, limit)
 	}
 
 	return data, nil
+}
+
+// syntheticStatus returns StatusSuccess if the item was listed (black or white), otherwise StatusNotFound
+func syntheticStatus(data *JsonRecord) string {
+
+	if data.Results[0].Found || data.Results[0].Wl {
+		return StatusSuccess
+	}
 
+	return StatusNotFound
 }
 
-// TODO: getInfo returns a struct with expanded information on why the result listed
-func (myapi Api) getInfo(resp *http.Response) (status bool, err error) {
+// getInfo returns a struct with expanded information on why the result listed, from a jsonx response
+func (myapi Api) getInfo(resp *http.Response) (reason JsonReason, err error) {
+
+	if myapi.ApiMethod != "jsonx" {
+		return reason, ErrNoReason
+	}
+
+	data, err := myapi.parseResult(resp)
+
+	if err != nil {
+		return reason, err
+	}
 
-	return true, nil
+	return myapi.Reason(&data)
 
 }
 
@@ -481,6 +1363,18 @@ func (myapi Api) IsBlackList(response *JsonRecord) (status bool) {
 
 }
 
+// IsListed queries an item and returns only if it is blacklisted (found and not whitelisted)
+func (myapi Api) IsListed(query string) (bool, error) {
+
+	response, err := myapi.Query(query)
+
+	if err != nil {
+		return false, err
+	}
+
+	return myapi.IsBlackList(&response), nil
+}
+
 // Return the score if a result matched a whitelist/blacklist on the MTA/default score
 func (myapi Api) Score(response *JsonRecord) (score float64) {
 
@@ -505,7 +1399,8 @@ func (myapi Api) WebScore(response *JsonRecord) (score float64) {
 
 }
 
-// Toggle SSL support
+// Toggle SSL support, returning the protocol for ssl. The Api is not modified, switch protocols
+// with WithSSL, which refuses to send the API key in clear text.
 func (myapi Api) ToggleSSL(ssl bool) (str string) {
 
 	if ssl == false {
@@ -524,28 +1419,15 @@ func (myapi Api) GetConf() string {
 	return myapi.apiKey
 }
 
-// Preform a DNS query against the zetascan API
-func (myapi Api) ParseDNS(results []net.IP) (data JsonRecord, err error) {
+// Preform a DNS query against the zetascan API. With DnsType TXT, pass the TXT answers as txt: they
+// only fill Wldata and Extended.Reason (see parseTXT), Found still comes from the A answers.
+func (myapi Api) ParseDNS(results []net.IP, txt ...string) (data JsonRecord, err error) {
 
-	// Move to a function to init?
-	// Init our object (Results is a []struct must be manually created)
-	data = JsonRecord{
-		Results: []struct {
-			Item       string       `json:"item"`
-			Found      bool         `json:"found"`
-			Score      float64      `json:"score"`
-			WebScore   float64      `json:"webscore"`
-			FromSubnet bool         `json:"fromSubnet"`
-			Sources    []string     `json:"sources"`
-			Wl         bool         `json:"wl"`
-			Wldata     string       `json:"wldata"`
-			Extended   JsonExtended `json:"extended"`
-		}{
-			{},
-		},
-	}
+	// Init our object, the predicates expect one result
+	data = newRecord()
 
 	// Parse the result from DNS and build the struct similar to http/text/json(x) methods
+	data.ReturnCodes = append([]net.IP(nil), results...)
 
 	// List through all matches, do we have a hit?
 	for _, match := range results {
@@ -570,28 +1452,130 @@ func (myapi Api) ParseDNS(results []net.IP) (data JsonRecord, err error) {
 			//fmt.Println("URIBL abuse")
 		}
 
-		// IP White lists from DNSWL
-		if strings.HasPrefix(match.String(), "127.8.0") {
-			//fmt.Println("DNSWL whitelist")
+		// IP White lists from DNSWL, decode the category and trust level (keep the highest)
+		if dnswl, ok := parseDNSWL(match); ok && (data.DNSWL == nil || dnswl.Trust > data.DNSWL.Trust) {
+			data.DNSWL = &dnswl
 		}
 
 	}
 
+	if len(txt) > 0 {
+		parseTXT(&data, txt)
+	}
+
+	// DNS has no status field
+	data.Status = syntheticStatus(&data)
+
 	return data, nil
 
 }
 
-// Preform a DNS query against the zetascan API
+// parseTXT aggregates TXT answers into the first result, de-duplicated in answer order: every
+// string is joined into Wldata with "; ", and class=, rule= and type= tokens (separated by spaces,
+// commas or semicolons) are joined into the matching Extended.Reason fields with ", "
+func parseTXT(data *JsonRecord, txt []string) {
+
+	var wldata, class, rule, kind []string
+
+	for _, answer := range txt {
+
+		answer = strings.TrimSpace(answer)
+
+		if answer == "" {
+			continue
+		}
+
+		wldata = appendUnique(wldata, answer)
+
+		tokens := strings.FieldsFunc(answer, func(r rune) bool {
+			return r == ' ' || r == ',' || r == ';' || r == '\t'
+		})
+
+		for _, token := range tokens {
+
+			parts := strings.SplitN(token, "=", 2)
+
+			if len(parts) != 2 || parts[1] == "" {
+				continue
+			}
+
+			switch strings.ToLower(parts[0]) {
+			case "class":
+				class = appendUnique(class, parts[1])
+			case "rule":
+				rule = appendUnique(rule, parts[1])
+			case "type":
+				kind = appendUnique(kind, parts[1])
+			}
+		}
+	}
+
+	data.Results[0].Wldata = strings.Join(wldata, "; ")
+	data.Results[0].Extended.Reason.Class = strings.Join(class, ", ")
+	data.Results[0].Extended.Reason.Rule = strings.Join(rule, ", ")
+	data.Results[0].Extended.Reason.Type = strings.Join(kind, ", ")
+}
+
+// appendUnique appends value to list unless already present
+func appendUnique(list []string, value string) []string {
+
+	if containsString(list, value) {
+		return list
+	}
+
+	return append(list, value)
+}
+
+// DefaultDNSRetry is the default DnsRetries, the number of timed out DNS exchanges retried
+const DefaultDNSRetry = 2
+
+// Preform a DNS query against the zetascan API. Only A answers are returned, with DnsType TXT use
+// Query to get the TXT answers parsed into the record.
 func (myapi Api) QueryDNS(query string, retry int) (json []net.IP, err error) {
 
-	// Assemble our DNS query parts
-	msg := new(dns.Msg)
-	msg.Id = dns.Id()
-	msg.RecursionDesired = true
-	msg.Question = make([]dns.Question, 1)
+	return myapi.queryDNSContext(context.Background(), query, retry)
+}
 
-	// Build the query
-	msg.Question[0] = dns.Question{Name: dns.Fqdn(query), Qtype: dns.TypeA, Qclass: dns.ClassINET}
+// QueryDNSContext performs a DNS query like QueryDNS, retrying timed out exchanges DnsRetries
+// times. Retrying stops when ctx is done, returning ctx.Err().
+func (myapi Api) QueryDNSContext(ctx context.Context, query string) (json []net.IP, err error) {
+
+	return myapi.queryDNSContext(ctx, query, myapi.DnsRetries)
+}
+
+// queryDNSContext validates query and bounds ctx by Timeout before querying
+func (myapi Api) queryDNSContext(ctx context.Context, query string, retry int) (json []net.IP, err error) {
+
+	if myapi.isClosed() {
+		return nil, ErrClosed
+	}
+
+	if query, err = myapi.checkQuery(query); err != nil {
+		return nil, err
+	}
+
+	if myapi.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, myapi.Timeout)
+		defer cancel()
+	}
+
+	json, _, err = myapi.queryDNS(ctx, query, retry)
+
+	return json, err
+}
+
+// queryDNS performs the DNS lookup for QueryDNS, aborting when ctx is done. The TXT answers are
+// returned apart, when DnsType is TXT.
+func (myapi Api) queryDNS(ctx context.Context, query string, retry int) (json []net.IP, txt []string, err error) {
+
+	// DNS-over-HTTPS, for networks blocking outbound port 53
+	if myapi.DnsMethod == "doh" {
+		return myapi.queryDoH(ctx, query)
+	}
+
+	msg := myapi.dnsMsg(query)
+	msg.Id = dns.Id()
 
 	// Use the zetascan DNS server directly for the query
 
@@ -600,30 +1584,136 @@ func (myapi Api) QueryDNS(query string, retry int) (json []net.IP, err error) {
 	// Currenrtly using the v1 method
 	// dig baddomain.org @api.zetascan.com
 
-	in, err := dns.Exchange(msg, "api.zetascan.com:53")
+	client := new(dns.Client)
 
-	// Load the result(s) into a net.IP struct
-	result := []net.IP{}
+	for attempt := 0; ; attempt++ {
 
-	// Timeout? Try again, max retry times
-	if err != nil {
+		// Out of budget, don't start another attempt
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		in, _, err := client.ExchangeContext(ctx, msg, myapi.dnsServer())
+
+		if err == nil {
+			return dnsAnswers(in)
+		}
+
+		// The caller's deadline passed mid-attempt
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		// Timeout? Try again after a backoff, max retry times
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && retry > 0 {
+
+			if err := myapi.backoff().wait(ctx, attempt); err != nil {
+				return nil, nil, err
+			}
 
-		// Failed, try again ...
-		if strings.HasSuffix(err.Error(), "i/o timeout") && retry > 0 {
 			retry--
-			return myapi.QueryDNS(query, retry)
+			continue
 		}
 
-		return nil, err
+		return nil, nil, err
+
+	}
+}
+
+// dnsServer returns the host:port address of the nameserver to query
+func (myapi Api) dnsServer() string {
+
+	endpoint := myapi.DnsEndpoint
+
+	if endpoint == "" {
+		endpoint = EndpointAPI
+	}
 
+	// Already includes a port
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+
+	return net.JoinHostPort(endpoint, "53")
+}
+
+// dnsMsg assembles the DNS query parts for an item
+func (myapi Api) dnsMsg(query string) *dns.Msg {
+
+	msg := new(dns.Msg)
+	msg.RecursionDesired = true
+	msg.Question = make([]dns.Question, 1)
+
+	qtype := dns.TypeA
+
+	if myapi.DnsType == "TXT" {
+		qtype = dns.TypeTXT
+	}
+
+	// Build the query
+	msg.Question[0] = dns.Question{Name: dns.Fqdn(myapi.dnsName(query)), Qtype: qtype, Qclass: dns.ClassINET}
+
+	return msg
+}
+
+// dnsName returns the name looked up for an item: the item itself, or under DnsZone DNSBL-style
+// (an IPv4 address with its octets reversed, e.g. 127.9.9.1 becomes 1.9.9.127.zone)
+func (myapi Api) dnsName(query string) string {
+
+	zone := strings.Trim(myapi.DnsZone, ".")
+
+	if zone == "" {
+		return query
+	}
+
+	if ip := net.ParseIP(query).To4(); ip != nil {
+		query = fmt.Sprintf("%d.%d.%d.%d", ip[3], ip[2], ip[1], ip[0])
+	}
+
+	return strings.TrimSuffix(query, ".") + "." + zone
+}
+
+// DNSError is returned when a DNS lookup failed with Rcode (SERVFAIL, REFUSED, ...): the item
+// couldn't be checked, unlike NXDOMAIN which is a clean not listed result. It wraps ErrDNSFailure.
+type DNSError struct {
+	Rcode int
+}
+
+func (e *DNSError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrDNSFailure, dns.RcodeToString[e.Rcode])
+}
+
+// Unwrap lets errors.Is match ErrDNSFailure
+func (e *DNSError) Unwrap() error {
+	return ErrDNSFailure
+}
+
+// dnsAnswers loads the A record result(s) of a DNS response into a net.IP slice, and the TXT
+// strings in answer order. NXDOMAIN is a clean not listed result, any other failure (SERVFAIL,
+// REFUSED, ...) means the item couldn't be checked and returns a *DNSError.
+func dnsAnswers(in *dns.Msg) ([]net.IP, []string, error) {
+
+	result := []net.IP{}
+	var txt []string
+
+	switch in.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		return result, nil, nil
+	default:
+		return nil, nil, &DNSError{Rcode: in.Rcode}
 	}
 
-	// Append all responses into an array
+	// Append all responses into an array, a TXT record split in several strings is one answer
 	for _, record := range in.Answer {
-		if t, ok := record.(*dns.A); ok {
+		switch t := record.(type) {
+		case *dns.A:
 			result = append(result, t.A)
+		case *dns.TXT:
+			txt = append(txt, strings.Join(t.Txt, ""))
 		}
 	}
 
-	return result, nil
+	return result, txt, nil
 }
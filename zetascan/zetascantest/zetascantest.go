@@ -0,0 +1,146 @@
+// Package zetascantest provides a fake zetascan API for testing code that uses the zetascan package
+package zetascantest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zetascanio/go-zetascan/zetascan"
+)
+
+// Server is a fake zetascan API answering the http, text, json and jsonx methods with canned
+// verdicts. Items without a verdict are clean.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	verdicts map[string]zetascan.Verdict
+}
+
+// result is the JSON shape of a single zetascan result
+type result struct {
+	Item     string   `json:"item"`
+	Found    bool     `json:"found"`
+	Score    float64  `json:"score"`
+	WebScore float64  `json:"webscore"`
+	Sources  []string `json:"sources"`
+	Wl       bool     `json:"wl"`
+	Wldata   string   `json:"wldata"`
+}
+
+// NewServer starts a fake API answering with verdicts, close it when done
+func NewServer(verdicts map[string]zetascan.Verdict) *Server {
+
+	server := &Server{verdicts: make(map[string]zetascan.Verdict)}
+
+	for item, verdict := range verdicts {
+		server.verdicts[item] = verdict
+	}
+
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serve))
+
+	return server
+}
+
+// Set changes the verdict returned for item
+func (server *Server) Set(item string, verdict zetascan.Verdict) {
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.verdicts[item] = verdict
+}
+
+// Api returns an Api querying the fake server with method (http, text, json or jsonx)
+func (server *Server) Api(method string) (*zetascan.Api, error) {
+
+	myapi, err := zetascan.Api{}.Init("zetascantest", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if myapi, err = myapi.WithEndpoint(strings.TrimPrefix(server.URL, "https://")); err != nil {
+		return nil, err
+	}
+
+	if myapi, err = myapi.WithMethod(method); err != nil {
+		return nil, err
+	}
+
+	myapi = myapi.WithHTTPClient(server.Client())
+
+	return &myapi, nil
+}
+
+// lookup returns the canned result for item
+func (server *Server) lookup(item string) result {
+
+	server.mu.Lock()
+	verdict := server.verdicts[item]
+	server.mu.Unlock()
+
+	switch verdict {
+	case zetascan.VerdictBlackList:
+		return result{Item: item, Found: true, Score: 1, WebScore: 0.6, Sources: []string{"dbl"}}
+	case zetascan.VerdictWhiteList:
+		return result{Item: item, Wl: true, Score: -0.1, WebScore: -0.1, Sources: []string{"white"}}
+	}
+
+	return result{Item: item}
+}
+
+// serve answers /{version}/check/{method}/{item}
+func (server *Server) serve(w http.ResponseWriter, r *http.Request) {
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(parts) != 4 || parts[1] != "check" {
+		http.NotFound(w, r)
+		return
+	}
+
+	found := server.lookup(parts[3])
+
+	status := zetascan.StatusNotFound
+
+	if found.Found || found.Wl {
+		status = zetascan.StatusSuccess
+	}
+
+	switch parts[2] {
+	case "http":
+		w.Header().Set("x-zetascan-items", found.Item)
+		w.Header().Set("x-zetascan-score", strconv.FormatFloat(found.Score, 'f', -1, 64))
+		w.Header().Set("x-zetascan-webscore", strconv.FormatFloat(found.WebScore, 'f', -1, 64))
+		w.Header().Set("x-zetascan-sources", strings.Join(found.Sources, ";"))
+		w.Header().Set("x-zetascan-status", status)
+		w.WriteHeader(http.StatusOK)
+
+	case "text":
+		fields := append([]string{
+			strconv.FormatBool(found.Found),
+			strconv.FormatBool(found.Wl),
+			found.Wldata,
+			strconv.FormatFloat(found.Score, 'f', -1, 64),
+			strconv.FormatFloat(found.WebScore, 'f', -1, 64),
+		}, found.Sources...)
+		fmt.Fprintf(w, "%s:%s\n", found.Item, strings.Join(fields, ","))
+
+	case "json", "jsonx":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results":       []result{found},
+			"executionTime": 1,
+			"status":        status,
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
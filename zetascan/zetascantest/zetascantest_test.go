@@ -0,0 +1,46 @@
+package zetascantest
+
+import (
+	"testing"
+
+	"github.com/zetascanio/go-zetascan/zetascan"
+)
+
+func TestServer(t *testing.T) {
+
+	server := NewServer(map[string]zetascan.Verdict{"baddomain.org": zetascan.VerdictBlackList})
+	defer server.Close()
+
+	server.Set("okdomain.org", zetascan.VerdictWhiteList)
+
+	tests := []struct {
+		item    string
+		verdict zetascan.Verdict
+	}{
+		{"baddomain.org", zetascan.VerdictBlackList},
+		{"okdomain.org", zetascan.VerdictWhiteList},
+		{"unknown.example", zetascan.VerdictClean},
+	}
+
+	for _, method := range []string{"http", "text", "json", "jsonx"} {
+
+		myapi, err := server.Api(method)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range tests {
+
+			m, err := myapi.Query(test.item)
+
+			if err != nil {
+				t.Fatalf("%s %s: %v", method, test.item, err)
+			}
+
+			if verdict, reason := myapi.Verdict(&m); verdict != test.verdict {
+				t.Errorf("%s %s: verdict %v (%s), want %v", method, test.item, verdict, reason, test.verdict)
+			}
+		}
+	}
+}